@@ -18,12 +18,34 @@ func main() {
 		Port:              utils.GetEnvInt("PORT"),
 		RequestMode:       utils.ValidateRequestMode(),
 		Timeout:           utils.HandleDuration("s", "TIMEOUT", configs.DEFAULT_INCOMING_REQUEST_TIMEOUT),
+		MinTimeout:        utils.HandleDuration("s", "MIN_TIMEOUT", configs.DEFAULT_MIN_TIMEOUT),
+		MaxTimeout:        utils.HandleDuration("s", "MAX_TIMEOUT", 0),
 		PriorityQueueSize: utils.HandlePriorityQueueSize(),
+		PriorityReserve:   utils.HandlePriorityReserve(),
+		PriorityClasses:   utils.HandlePriorityClasses(),
+		DefaultPriority:   utils.GetSoftEnvString("DEFAULT_PRIORITY", ""),
 		PrometheusEnabled: strings.ToLower(utils.GetSoftEnvString("PROMETHEUS", "OFF")) == "on",
 		PollingInterval:   utils.HandleDuration("ms", "POLLING_INTERVAL", configs.DEFAULT_POLLING_INTERVAL),
 		AdditionalWindowSize: utils.HandleDuration("ms", "ADDITIONAL_WINDOW_SIZE",
 			configs.DEFAULT_ADDITIONAL_WINDOW_SIZE),
-		UserAgent: utils.GetSoftEnvString("USER_AGENT", configs.DEFAULT_USER_AGENT),
+		UserAgent:             utils.GetSoftEnvString("USER_AGENT", configs.DEFAULT_USER_AGENT),
+		SchemaSource:          utils.GetSoftEnvString("SCHEMA_SOURCE", ""),
+		SchemaRefreshInterval: utils.HandleDuration("m", "SCHEMA_REFRESH_INTERVAL", 0),
+		SnapshotPath:          utils.GetSoftEnvString("SNAPSHOT_PATH", ""),
+		SnapshotInterval:      utils.HandleDuration("s", "SNAPSHOT_INTERVAL", configs.DEFAULT_SNAPSHOT_INTERVAL),
+		SnapshotMaxAge:        utils.HandleDuration("m", "SNAPSHOT_MAX_AGE", configs.DEFAULT_SNAPSHOT_MAX_AGE),
+		RateLimitSeeds:        utils.HandleRateLimitSeeds(),
+		MaxRetries:            utils.GetSoftEnvInt("MAX_RETRIES", 0),
+		CircuitBreaker:        utils.HandleCircuitBreaker(),
+		Cache:                 utils.HandleCache(),
+		CoalesceRequests:      strings.ToLower(utils.GetSoftEnvString("COALESCE_REQUESTS", "OFF")) == "on",
+		ResponseStore:         utils.HandleResponseStore(),
+		StoreEndpoints:        utils.HandleStoreEndpoints(),
+		Tenants:               utils.HandleTenants(),
+		AuthFile:              utils.GetSoftEnvString("AUTH_FILE", ""),
+		AdminPort:             utils.GetSoftEnvInt("ADMIN_PORT", 0),
+		AdminToken:            utils.GetSoftEnvString("ADMIN_TOKEN", ""),
+		ShutdownDelay:         utils.HandleDuration("s", "SHUTDOWN_DELAY", 0),
 	})
 
 	limiter.Start()
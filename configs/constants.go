@@ -5,6 +5,9 @@ import "time"
 // Incoming request timeout configs. This variable can be changed with a .env file.
 const DEFAULT_INCOMING_REQUEST_TIMEOUT = 10 * time.Second
 
+// Lower bound of the timeout clients can set with the X-Timeout header
+const DEFAULT_MIN_TIMEOUT = 1 * time.Second
+
 // Interval in which the rate limit is checked against the Riot Games API.
 // It is very unlikely that rate limits change, but it should be accounted for.
 const RATELIMIT_UPDATE_INTERVAL = time.Minute * 1
@@ -24,11 +27,74 @@ const DEFAULT_ADDITIONAL_WINDOW_SIZE = 125 * time.Millisecond
 // Maximum utilization of a rate limit in percent.
 const MAX_UTILIZATION_FACTOR = 1
 
+// Backoff of a method on a platform after a service rate limit or a 503. Doubles with every consecutive failure
+const SERVICE_BACKOFF_BASE = 1 * time.Second
+const SERVICE_BACKOFF_MAX = 60 * time.Second
+
+// Failures further apart than this are not considered consecutive
+const SERVICE_BACKOFF_RESET = 2 * SERVICE_BACKOFF_MAX
+
+// Backoff before the first retry of a failed upstream request. Doubles with every attempt
+const RETRY_BACKOFF_BASE = 250 * time.Millisecond
+
+// Circuit breaker defaults, the breaker itself is disabled by default
+const DEFAULT_CIRCUIT_BREAKER_MIN_REQUESTS = 20
+const DEFAULT_CIRCUIT_BREAKER_WINDOW = 30 * time.Second
+const DEFAULT_CIRCUIT_BREAKER_OPEN_DURATION = 30 * time.Second
+
+// TTL of cached 404 responses
+const DEFAULT_CACHE_NOT_FOUND_TTL = 60 * time.Second
+
+// Responses larger than this fraction of the cache size are not cached
+const CACHE_MAX_ENTRY_FRACTION = 16
+
+// Size limit of the response store in bytes, if enabled
+const DEFAULT_STORE_SIZE = 1 << 30
+
+// Amount of responses that can be written to the response store at the same time, others are not stored
+const MAX_PENDING_STORE_WRITES = 64
+
+// Immutable endpoints whose responses are kept in the response store by default
+const DEFAULT_STORE_ENDPOINTS = "lol/match/v5/matches/{matchId},lol/match/v5/matches/{matchId}/timeline"
+
+// Amount of refunds that can be waiting for the main loop
+const REFUND_BUFFER_SIZE = 1024
+
 const MAX_BATCH_SIZE_NORMAL = 25
 const MAX_BATCH_SIZE_PRIORITY = MAX_BATCH_SIZE_NORMAL * 5
 
+// Maximum size of a request body that gets forwarded to the Riot Games API
+const MAX_REQUEST_BODY_SIZE = 1 << 20
+
 // Default user agent cosmic-radiance will be using
 const DEFAULT_USER_AGENT = "cosmic-radiance/" + VERSION + " (+https://github.com/DarkIntaqt/cosmic-radiance)"
 
+// Interval in which the rate limit snapshot is written to disk, if enabled
+const DEFAULT_SNAPSHOT_INTERVAL = 30 * time.Second
+
+// Rate limit snapshots older than this are ignored at startup
+const DEFAULT_SNAPSHOT_MAX_AGE = 1 * time.Hour
+
+// Interval in which the client credentials file is checked for changes, if authentication is enabled
+const AUTH_RELOAD_INTERVAL = 10 * time.Second
+
+// Rejected requests are logged at most once in this interval, with the amount of rejections since the last log
+const AUTH_LOG_INTERVAL = 1 * time.Minute
+
+// Time the admin API waits for the main loop to answer
+const ADMIN_REQUEST_TIMEOUT = 5 * time.Second
+
+// Retry-After of requests to methods which are paused on every key
+const PAUSED_RETRY_AFTER = 5 * time.Second
+
+// Interval in which the main loop updates the state of the readiness probe
+const HEALTH_UPDATE_INTERVAL = 1 * time.Second
+
+// The main loop is considered dead if it didn't tick for this long, on top of the polling interval
+const HEALTH_MAX_TICK_AGE = 5 * time.Second
+
+// Keys rejected by Riot with 401 are considered invalid for this long, unless they succeed again
+const INVALID_KEY_DURATION = 1 * time.Minute
+
 // Default error key shown in prometheus
 const DEFAULT_NO_KEY = "NO-KEY"
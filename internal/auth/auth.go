@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Headers of HMAC signed requests
+const (
+	ClientIdHeader  = "X-Client-Id"
+	TimestampHeader = "X-Timestamp"
+	SignatureHeader = "X-Signature"
+)
+
+// Signed requests are only accepted this long before or after their timestamp. Each signature is only accepted once within that time
+const MaxClockSkew = 5 * time.Minute
+
+// Credentials of a client, either a static bearer token or a secret to sign requests with
+type Client struct {
+	Token  string `json:"token"`
+	Secret string `json:"secret"`
+}
+
+/*
+Authenticates clients with the credentials of a JSON file, by client id. The file is reloaded by Reload whenever it changed,
+requests are authenticated concurrently, hence the credentials are guarded by a mutex
+*/
+type Authenticator struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	tokens  map[[sha256.Size]byte]string // client id by hash of the token
+	secrets map[string][]byte            // by client id
+
+	// Signatures which were already used, with the time they expire. Guarded separately, as they change with every signed request
+	seenMu    sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// Loads the credentials from the file. Fails if the file can't be read or is malformed
+func NewAuthenticator(path string) (*Authenticator, error) {
+	a := &Authenticator{path: path, seen: make(map[string]time.Time)}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+/*
+Reloads the credentials if the file changed since it was loaded last. Returns the amount of clients if it was reloaded, -1 otherwise.
+The current credentials are kept if the file is malformed
+*/
+func (a *Authenticator) Reload() (int, error) {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return -1, err
+	}
+
+	a.mu.RLock()
+	unchanged := info.ModTime().Equal(a.modTime)
+	a.mu.RUnlock()
+	if unchanged {
+		return -1, nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return -1, err
+	}
+
+	clients := map[string]Client{}
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return -1, err
+	}
+
+	tokens := make(map[[sha256.Size]byte]string)
+	secrets := make(map[string][]byte)
+	for id, client := range clients {
+		if id == "" || (client.Token == "" && client.Secret == "") {
+			return -1, fmt.Errorf("client %q needs an id and either a token or a secret", id)
+		}
+
+		if client.Token != "" {
+			tokens[sha256.Sum256([]byte(client.Token))] = id
+		}
+		if client.Secret != "" {
+			secrets[id] = []byte(client.Secret)
+		}
+	}
+
+	a.mu.Lock()
+	a.tokens, a.secrets, a.modTime = tokens, secrets, info.ModTime()
+	a.mu.Unlock()
+
+	return len(clients), nil
+}
+
+/*
+Returns the id of the client that sent the request. Clients either send their token in the Authorization header ("Bearer <token>"),
+or sign the request with their secret: X-Signature is the hex encoded HMAC-SHA256 of "<timestamp>\n<method>\n<host>\n<path and query>\n<body hash>",
+with the unix timestamp in seconds in X-Timestamp, the client id in X-Client-Id and the hex encoded SHA-256 of the body as body hash.
+The body of signed requests is read and replaced, so it can still be read afterwards. Signatures can't be replayed
+*/
+func (a *Authenticator) Authenticate(r *http.Request, now time.Time) (string, error) {
+	if token, Ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); Ok {
+		// Tokens are looked up by their hash, so the lookup doesn't depend on the token itself
+		a.mu.RLock()
+		id, Ok := a.tokens[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+		a.mu.RUnlock()
+
+		if Ok {
+			return id, nil
+		}
+		return "", ErrInvalidCredentials
+	}
+
+	id := r.Header.Get(ClientIdHeader)
+	if id == "" {
+		return "", ErrMissingCredentials
+	}
+
+	// Reloads replace the secrets instead of modifying them, so the body is read without holding the lock
+	a.mu.RLock()
+	secret, Ok := a.secrets[id]
+	a.mu.RUnlock()
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if !Ok || err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return "", ErrInvalidCredentials
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil || !hmac.Equal(signature, Sign(secret, timestamp, r.Method, r.Host, r.URL.RequestURI(), body)) {
+		return "", ErrInvalidCredentials
+	}
+
+	if !a.firstUse(signature, time.Unix(timestamp, 0).Add(MaxClockSkew), now) {
+		return "", fmt.Errorf("%w: signature was already used", ErrInvalidCredentials)
+	}
+
+	return id, nil
+}
+
+/*
+INTERNAL:
+Remembers a signature until it expires. Returns false if it was already used.
+Expired signatures are removed once a minute, they are rejected by their timestamp anyway
+*/
+func (a *Authenticator) firstUse(signature []byte, expires time.Time, now time.Time) bool {
+	a.seenMu.Lock()
+	defer a.seenMu.Unlock()
+
+	if now.Sub(a.lastSweep) >= time.Minute {
+		a.lastSweep = now
+		for key, expiry := range a.seen {
+			if now.After(expiry) {
+				delete(a.seen, key)
+			}
+		}
+	}
+
+	key := string(signature)
+	if _, Ok := a.seen[key]; Ok {
+		return false
+	}
+
+	a.seen[key] = expires
+	return true
+}
+
+// INTERNAL: Reads the body of a request and replaces it, so it can be read again
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	// Larger bodies are rejected later on anyway
+	body, err := io.ReadAll(io.LimitReader(r.Body, configs.MAX_REQUEST_BODY_SIZE+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Returns the signature of a request, as expected in the X-Signature header (hex encoded)
+func Sign(secret []byte, timestamp int64, method string, host string, requestURI string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n%s", timestamp, method, host, requestURI, hex.EncodeToString(bodyHash[:]))
+	return mac.Sum(nil)
+}
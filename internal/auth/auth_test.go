@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testClients = `{
+	"frontend": { "token": "frontend-token" },
+	"crawler": { "secret": "crawler-secret" }
+}`
+
+func newTestAuthenticator(t *testing.T, clients string) (*Authenticator, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "clients.json")
+	if err := os.WriteFile(path, []byte(clients), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a, path
+}
+
+// Returns a request signed like ratelimiter.SignRequest does
+func signedRequest(method string, target string, body string, id string, secret string, timestamp time.Time) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	signature := Sign([]byte(secret), timestamp.Unix(), method, r.Host, r.URL.RequestURI(), []byte(body))
+
+	r.Header.Set(ClientIdHeader, id)
+	r.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	r.Header.Set(SignatureHeader, hex.EncodeToString(signature))
+	return r
+}
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	path := "/europe/lol/match/v5/matches/EUW1_1"
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		client  string
+		err     error
+	}{
+		{
+			name: "valid token",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				r.Header.Set("Authorization", "Bearer frontend-token")
+				return r
+			},
+			client: "frontend",
+		},
+		{
+			name: "invalid token",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				r.Header.Set("Authorization", "Bearer wrong-token")
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "missing credentials",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, path, nil)
+			},
+			err: ErrMissingCredentials,
+		},
+		{
+			name: "valid signature",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now)
+			},
+			client: "crawler",
+		},
+		{
+			name: "valid signature with body",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/americas/lol/tournament/v5/codes?count=1", `{"mapType":"SUMMONERS_RIFT"}`, "crawler", "crawler-secret", now)
+			},
+			client: "crawler",
+		},
+		{
+			name: "signature within clock skew",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now.Add(-MaxClockSkew+time.Second))
+			},
+			client: "crawler",
+		},
+		{
+			name: "wrong secret",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "crawler", "wrong-secret", now)
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "malformed signature",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now)
+				r.Header.Set(SignatureHeader, "not-hex")
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "tampered path",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now)
+				r.URL.Path = "/europe/lol/match/v5/matches/EUW1_2"
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "tampered host",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now)
+				r.Host = "other.example.com"
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodPost, "/americas/lol/tournament/v5/codes?count=1", `{"mapType":"SUMMONERS_RIFT"}`, "crawler", "crawler-secret", now)
+				r.Body = httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"mapType":"HOWLING_ABYSS"}`)).Body
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "expired signature",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now.Add(-MaxClockSkew-time.Second))
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "signature from the future",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now.Add(MaxClockSkew+time.Second))
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "unknown client",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "unknown", "crawler-secret", now)
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "token client signing",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, path, "", "frontend", "frontend-token", now)
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name: "missing timestamp",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, path, "", "crawler", "crawler-secret", now)
+				r.Header.Del(TimestampHeader)
+				return r
+			},
+			err: ErrInvalidCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, _ := newTestAuthenticator(t, testClients)
+
+			client, err := a.Authenticate(test.request(), now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if client != test.client {
+				t.Fatalf("expected client %q, got %q", test.client, client)
+			}
+		})
+	}
+}
+
+func TestAuthenticateReplay(t *testing.T) {
+	a, _ := newTestAuthenticator(t, testClients)
+	now := time.Unix(1_700_000_000, 0)
+
+	body := `{"mapType":"SUMMONERS_RIFT"}`
+	first := signedRequest(http.MethodPost, "/americas/lol/tournament/v5/codes", body, "crawler", "crawler-secret", now)
+	replay := signedRequest(http.MethodPost, "/americas/lol/tournament/v5/codes", body, "crawler", "crawler-secret", now)
+
+	if _, err := a.Authenticate(first, now); err != nil {
+		t.Fatalf("expected the first request to be accepted, got %v", err)
+	}
+
+	// The body can still be read after it was hashed
+	if read, _ := first.Body.Read(make([]byte, len(body))); read != len(body) {
+		t.Fatalf("expected the body to be readable after authentication, read %d bytes", read)
+	}
+
+	if _, err := a.Authenticate(replay, now.Add(time.Second)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the replay to be rejected, got %v", err)
+	}
+
+	// Forgetting expired signatures doesn't accept them again, their timestamp is too old by then
+	later := now.Add(2 * MaxClockSkew)
+	if _, err := a.Authenticate(signedRequest(http.MethodPost, "/americas/lol/tournament/v5/codes", body, "crawler", "crawler-secret", now), later); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the expired replay to be rejected, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	a, path := newTestAuthenticator(t, testClients)
+	now := time.Now()
+
+	tokenRequest := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/europe/lol/match/v5/matches/EUW1_1", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	// Unchanged files aren't loaded again
+	if clients, err := a.Reload(); clients != -1 || err != nil {
+		t.Fatalf("expected no reload of an unchanged file, got %d clients and %v", clients, err)
+	}
+
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{ "frontend": { "token": "rotated-token" } }`, now.Add(time.Minute))
+	if clients, err := a.Reload(); clients != 1 || err != nil {
+		t.Fatalf("expected 1 client after the reload, got %d and %v", clients, err)
+	}
+
+	if _, err := a.Authenticate(tokenRequest("frontend-token"), now); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the old token to be rejected, got %v", err)
+	}
+
+	if client, err := a.Authenticate(tokenRequest("rotated-token"), now); client != "frontend" || err != nil {
+		t.Fatalf("expected the new token to be accepted, got %q and %v", client, err)
+	}
+
+	// Malformed files keep the current credentials
+	write(`{ "frontend": `, now.Add(2*time.Minute))
+	if _, err := a.Reload(); err == nil {
+		t.Fatal("expected an error for a malformed file")
+	}
+
+	if client, err := a.Authenticate(tokenRequest("rotated-token"), now); client != "frontend" || err != nil {
+		t.Fatalf("expected the current token to be kept, got %q and %v", client, err)
+	}
+
+	// Clients need credentials
+	write(`{ "frontend": {} }`, now.Add(3*time.Minute))
+	if _, err := a.Reload(); err == nil {
+		t.Fatal("expected an error for a client without credentials")
+	}
+}
@@ -0,0 +1,114 @@
+package breaker
+
+import (
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+type State int
+
+const (
+	Closed   State = iota // requests pass
+	HalfOpen              // a single probe request passes
+	Open                  // requests fail fast
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Circuit breaker of a single platform or method. Not thread safe, Breakers takes care of locking
+type breaker struct {
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probeAt     time.Time // time the current probe was let through, zero if none is in flight
+
+	// Labels for logs and metrics
+	platform   string
+	endpoint   string
+	httpMethod string
+}
+
+/*
+INTERNAL:
+Returns whether a request may pass. Open breakers turn half-open after the open duration
+and let a single probe through. Returns the time a new attempt makes sense if the request may not pass
+*/
+func (b *breaker) allow(opts *options.CircuitBreakerOptions, now time.Time) (bool, time.Time) {
+	if b.state == Open {
+		reopenAt := b.openedAt.Add(opts.OpenDuration)
+		if now.Before(reopenAt) {
+			return false, reopenAt
+		}
+		b.state = HalfOpen
+		b.probeAt = time.Time{}
+	}
+
+	if b.state == HalfOpen {
+		// A probe that never reported back, e.g. because it timed out in the queue, doesn't block forever
+		if !b.probeAt.IsZero() && now.Before(b.probeAt.Add(opts.OpenDuration)) {
+			return false, b.probeAt.Add(opts.OpenDuration)
+		}
+		b.probeAt = now
+	}
+
+	return true, time.Time{}
+}
+
+/*
+INTERNAL:
+Records the outcome of an upstream request. Opens the breaker once the error ratio within the window is exceeded.
+A failed probe opens the breaker again, a successful one closes it
+*/
+func (b *breaker) report(opts *options.CircuitBreakerOptions, success bool, now time.Time) {
+	switch b.state {
+	case HalfOpen:
+		if success {
+			b.reset(now)
+			b.state = Closed
+		} else {
+			b.open(now)
+		}
+		return
+
+	case Open:
+		// Outcomes of requests which were dispatched before the breaker opened
+		return
+	}
+
+	if now.Sub(b.windowStart) > opts.Window {
+		b.reset(now)
+	}
+
+	b.requests++
+	if !success {
+		b.failures++
+	}
+
+	if b.requests >= opts.MinRequests && float64(b.failures)/float64(b.requests) >= opts.ErrorRatio {
+		b.open(now)
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.probeAt = time.Time{}
+}
+
+func (b *breaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
@@ -0,0 +1,99 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+// Called whenever a breaker changes its state
+type StateChangeFunc func(platform string, endpoint string, httpMethod string, from State, to State)
+
+/*
+Circuit breakers per platform or per method. Unlike the queues, breakers are accessed by every request directly,
+hence they are guarded by a mutex instead of the main loop
+*/
+type Breakers struct {
+	mu            sync.Mutex
+	breakers      map[string]*breaker
+	opts          *options.CircuitBreakerOptions
+	onStateChange StateChangeFunc
+}
+
+func NewBreakers(opts *options.CircuitBreakerOptions, onStateChange StateChangeFunc) *Breakers {
+	return &Breakers{
+		breakers:      make(map[string]*breaker),
+		opts:          opts,
+		onStateChange: onStateChange,
+	}
+}
+
+// Returns whether circuit breakers are enabled at all
+func (b *Breakers) Enabled() bool {
+	return b.opts.ErrorRatio > 0
+}
+
+/*
+Returns whether a request may be sent upstream. If not, the time after which a new attempt makes sense is returned
+*/
+func (b *Breakers) Allow(syntax *schema.Syntax, now time.Time) (bool, time.Time) {
+	if !b.Enabled() {
+		return true, time.Time{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(syntax, now)
+	from := br.state
+	allowed, retryAt := br.allow(b.opts, now)
+	b.notify(br, from)
+
+	return allowed, retryAt
+}
+
+// Records the outcome of an upstream request. Transport failures and 5xx count as failures
+func (b *Breakers) Report(syntax *schema.Syntax, success bool, now time.Time) {
+	if !b.Enabled() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(syntax, now)
+	from := br.state
+	br.report(b.opts, success, now)
+	b.notify(br, from)
+}
+
+func (b *Breakers) get(syntax *schema.Syntax, now time.Time) *breaker {
+	key := syntax.Platform
+	if b.opts.PerMethod {
+		key = syntax.Id
+	}
+
+	br, Ok := b.breakers[key]
+	if !Ok {
+		br = &breaker{
+			state:       Closed,
+			windowStart: now,
+			platform:    syntax.Platform,
+		}
+		if b.opts.PerMethod {
+			br.endpoint = syntax.Endpoint
+			br.httpMethod = syntax.HttpMethod
+		}
+		b.breakers[key] = br
+	}
+
+	return br
+}
+
+func (b *Breakers) notify(br *breaker, from State) {
+	if from != br.state && b.onStateChange != nil {
+		b.onStateChange(br.platform, br.endpoint, br.httpMethod, from, br.state)
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A response as received from the Riot Games API. The body is kept encoded, so it can be written 1:1
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Expires    time.Time // zero if the entry never expires
+	key        string
+	size       int64
+}
+
+/*
+LRU cache of responses limited by the size of its entries.
+The cache is accessed by every request directly, hence it is guarded by a mutex
+*/
+type Cache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // front is the most recently used entry
+	size     int64
+	maxBytes int64
+	maxEntry int64
+}
+
+func NewCache(maxBytes int64, maxEntry int64) *Cache {
+	return &Cache{
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		maxBytes: maxBytes,
+		maxEntry: maxEntry,
+	}
+}
+
+// Returns the entry of the key, if it exists and hasn't expired yet
+func (c *Cache) Get(key string, now time.Time) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, Ok := c.entries[key]
+	if !Ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*Entry)
+	if !entry.Expires.IsZero() && !now.Before(entry.Expires) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+/*
+Stores a response and evicts the least recently used entries until the cache fits its size again.
+Responses larger than the entry limit are not stored, so they can't flush the whole cache
+*/
+func (c *Cache) Set(key string, statusCode int, header http.Header, body []byte, expires time.Time) {
+	entry := &Entry{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       body,
+		Expires:    expires,
+		key:        key,
+		size:       entrySize(key, header, body),
+	}
+
+	if entry.size > c.maxEntry {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, Ok := c.entries[key]; Ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += entry.size
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Returns the current size of all entries in bytes
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+func (c *Cache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*Entry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// Approximate memory used by an entry
+func entrySize(key string, header http.Header, body []byte) int64 {
+	size := len(key) + len(body)
+	for name, values := range header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+
+	return int64(size)
+}
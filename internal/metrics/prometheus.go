@@ -5,6 +5,7 @@ import (
 
 	"github.com/DarkIntaqt/cosmic-radiance/internal/queue"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -14,29 +15,38 @@ var (
 	queueSize        *prometheus.GaugeVec
 	queueFilled      *prometheus.GaugeVec
 	queueCount       *prometheus.GaugeVec
+	refundedTokens   *prometheus.CounterVec
+	breakerState     *prometheus.GaugeVec
+	cacheRequests    *prometheus.CounterVec
+	cacheSize        prometheus.Gauge
+	coalescedCount   *prometheus.CounterVec
+	storeRequests    *prometheus.CounterVec
+	tenantRequests   *prometheus.CounterVec
+	tenantQueued     *prometheus.GaugeVec
+	authFailures     *prometheus.CounterVec
 )
 
 func InitMetrics() {
 	keyResponseCodes = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "key_response_code_count",
-			Help: "Number of responses by key ID, platform, endpoint and response code",
+			Help: "Number of responses by key ID, platform, endpoint, HTTP method and response code",
 		},
-		[]string{"key_name", "platform", "endpoint", "response_code"},
+		[]string{"key_name", "platform", "endpoint", "http_method", "response_code"},
 	)
 	queueSize = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "queue_max_size",
 			Help: "Maximum size of a queue",
 		},
-		[]string{"platform", "endpoint", "priority"},
+		[]string{"platform", "endpoint", "http_method", "priority"},
 	)
 	queueFilled = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "queue_currently_filled",
 			Help: "Current amount of requests in the queue",
 		},
-		[]string{"platform", "endpoint", "priority"},
+		[]string{"platform", "endpoint", "http_method", "priority"},
 	)
 	queueCount = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -45,38 +55,165 @@ func InitMetrics() {
 		},
 		[]string{"priority"},
 	)
+	refundedTokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "refunded_token_count",
+			Help: "Number of rate limit tokens returned by key ID, platform, endpoint, HTTP method and reason",
+		},
+		[]string{"key_name", "platform", "endpoint", "http_method", "reason"},
+	)
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of a circuit breaker by platform, endpoint and HTTP method (0 closed, 1 half-open, 2 open). Endpoint and HTTP method are empty for per platform breakers",
+		},
+		[]string{"platform", "endpoint", "http_method"},
+	)
+	cacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_request_count",
+			Help: "Number of cache lookups by platform, endpoint, HTTP method and result (hit or miss)",
+		},
+		[]string{"platform", "endpoint", "http_method", "result"},
+	)
+	cacheSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cache_size_bytes",
+			Help: "Current size of all cached responses in bytes",
+		},
+	)
+	coalescedCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coalesced_request_count",
+			Help: "Number of requests served by the upstream call of an identical request, by platform, endpoint and HTTP method",
+		},
+		[]string{"platform", "endpoint", "http_method"},
+	)
+	storeRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "response_store_request_count",
+			Help: "Number of response store lookups by platform, endpoint, HTTP method and result (hit or miss)",
+		},
+		[]string{"platform", "endpoint", "http_method", "result"},
+	)
+	tenantRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_request_count",
+			Help: "Number of queued requests by tenant and result (dispatched, rejected or timeout)",
+		},
+		[]string{"tenant", "result"},
+	)
+	tenantQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_queue_filled",
+			Help: "Current amount of requests in all queues by tenant",
+		},
+		[]string{"tenant"},
+	)
+	authFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_failure_count",
+			Help: "Number of requests rejected because of missing or invalid credentials, by reason",
+		},
+		[]string{"reason"},
+	)
 }
 
-func UpdateResponseCodes(keyName string, platform string, endpoint string, responseCode int) {
+func UpdateResponseCodes(keyName string, platform string, httpMethod string, endpoint string, responseCode int) {
 	code := strconv.Itoa(responseCode)
 	endpoint = "/" + endpoint
 
-	keyResponseCodes.WithLabelValues(keyName, platform, endpoint, code).Inc()
+	keyResponseCodes.WithLabelValues(keyName, platform, endpoint, httpMethod, code).Inc()
+}
+
+func UpdateRefunds(keyName string, platform string, httpMethod string, endpoint string, reason string) {
+	endpoint = "/" + endpoint
+
+	refundedTokens.WithLabelValues(keyName, platform, endpoint, httpMethod, reason).Inc()
 }
 
-func UpdateQueueSizes(qm *queue.QueueManager) {
-	normal := 0
-	priority := 0
+func UpdateBreakerState(platform string, httpMethod string, endpoint string, state int) {
+	if endpoint != "" {
+		endpoint = "/" + endpoint
+	}
+
+	breakerState.WithLabelValues(platform, endpoint, httpMethod).Set(float64(state))
+}
+
+func UpdateCacheRequests(platform string, httpMethod string, endpoint string, hit bool) {
+	endpoint = "/" + endpoint
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	cacheRequests.WithLabelValues(platform, endpoint, httpMethod, result).Inc()
+}
+
+func UpdateCacheSize(size int64) {
+	cacheSize.Set(float64(size))
+}
+
+func UpdateCoalescedRequests(platform string, httpMethod string, endpoint string) {
+	endpoint = "/" + endpoint
+
+	coalescedCount.WithLabelValues(platform, endpoint, httpMethod).Inc()
+}
 
-	for platform, methods := range schema.AllowedPattern {
+func UpdateStoreRequests(platform string, httpMethod string, endpoint string, hit bool) {
+	endpoint = "/" + endpoint
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	storeRequests.WithLabelValues(platform, endpoint, httpMethod, result).Inc()
+}
+
+func UpdateTenantRequests(tenant string, result string) {
+	tenantRequests.WithLabelValues(tenant, result).Inc()
+}
+
+func UpdateAuthFailures(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
+
+func UpdateQueueSizes(qm *queue.QueueManager, opts *options.RateLimiterOptions) {
+	classes := opts.PriorityClasses
+	counts := make([]int, len(classes))
+	tenants := make(map[string]int64)
+
+	for platform, methods := range schema.AllowedPattern() {
 		for _, endpoint := range methods {
 			id := endpoint.Id
 			method := endpoint.Method
+			httpMethod := endpoint.HttpMethod
 
-			if curQueue, Ok := qm.Queues[id]; Ok {
-				queueSize.WithLabelValues(platform, method, "normal").Set(float64(curQueue.Size()))
-				queueFilled.WithLabelValues(platform, method, "normal").Set(float64(curQueue.Count()))
-				normal++
-			}
+			for priority, queues := range qm.Queues {
+				if curQueue, Ok := queues[id]; Ok {
+					queueSize.WithLabelValues(platform, method, httpMethod, classes[priority].Name).Set(float64(curQueue.Size()))
+					queueFilled.WithLabelValues(platform, method, httpMethod, classes[priority].Name).Set(float64(curQueue.Count()))
+					counts[priority]++
 
-			if curQueue, Ok := qm.PriorityQueues[id]; Ok {
-				queueSize.WithLabelValues(platform, method, "high").Set(float64(curQueue.Size()))
-				queueFilled.WithLabelValues(platform, method, "high").Set(float64(curQueue.Count()))
-				priority++
+					for tenant, count := range curQueue.TenantCounts() {
+						tenants[opts.TenantLabel(tenant)] += count
+					}
+				}
 			}
 		}
 	}
 
-	queueCount.WithLabelValues("normal").Set(float64(normal))
-	queueCount.WithLabelValues("high").Set(float64(priority))
+	for priority, class := range classes {
+		queueCount.WithLabelValues(class.Name).Set(float64(counts[priority]))
+	}
+
+	// Tenants without queued requests are reset to 0
+	if opts.TenantsEnabled() {
+		tenantQueued.Reset()
+		for tenant, count := range tenants {
+			tenantQueued.WithLabelValues(tenant).Set(float64(count))
+		}
+	}
 }
@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"strings"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+)
+
+// Pauses without a duration last until they are resumed
+var pausedForever = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Selects the queues and keys of an admin operation. Empty fields match everything
+type Target struct {
+	Platform   string `json:"platform,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"` // e.g. "lol/match/v5/matches/{matchId}"
+	HttpMethod string `json:"httpMethod,omitempty"`
+	Key        string `json:"key,omitempty"`      // name of the api key
+	Priority   string `json:"priority,omitempty"` // name of the priority class, only used to flush queues
+}
+
+// Dispatch of the targeted methods and keys is paused until the pause is over or resumed
+type Pause struct {
+	Target
+	Until time.Time `json:"until"`
+}
+
+func (t *Target) matchesRoute(platform string, endpoint string, httpMethod string) bool {
+	return (t.Platform == "" || t.Platform == platform) &&
+		(t.Endpoint == "" || t.Endpoint == endpoint) &&
+		(t.HttpMethod == "" || strings.EqualFold(t.HttpMethod, httpMethod))
+}
+
+func (t *Target) matchesQueue(rb *RingBuffer) bool {
+	return t.matchesRoute(rb.Syntax.Platform, rb.Syntax.Endpoint, rb.Syntax.HttpMethod) &&
+		(t.Priority == "" || t.Priority == rb.Class.Name)
+}
+
+// Returns whether the other target is within this one, e.g. a pause of a key on a platform is within a pause of the platform
+func (t *Target) contains(other Target) bool {
+	return (t.Platform == "" || t.Platform == other.Platform) &&
+		(t.Endpoint == "" || t.Endpoint == other.Endpoint) &&
+		(t.HttpMethod == "" || strings.EqualFold(t.HttpMethod, other.HttpMethod)) &&
+		(t.Key == "" || t.Key == other.Key)
+}
+
+func (t *Target) matchesKey(name string) bool {
+	return t.Key == "" || t.Key == name
+}
+
+/*
+Pauses the dispatch of the targeted methods and keys until the given time, forever if it is zero.
+Queued requests keep waiting and expire as usual. Returns the amount of paused rate limit groups.
+Has to be called from the main loop
+*/
+func (qm *QueueManager) Pause(target Target, until time.Time, now time.Time) int {
+	if until.IsZero() {
+		until = pausedForever
+	}
+
+	// Pausing the same target again replaces the previous pause
+	qm.removePauses(func(pause Target) bool { return pause == target })
+	qm.pauses = append(qm.pauses, Pause{Target: target, Until: until})
+
+	return qm.applyPauses(now)
+}
+
+/*
+Resumes all pauses within the target, e.g. every pause of a platform, including the pauses of single keys or methods on it.
+An empty target resumes all pauses. Returns the amount of resumed pauses. Has to be called from the main loop
+*/
+func (qm *QueueManager) Resume(target Target, now time.Time) int {
+	resumed := qm.removePauses(target.contains)
+
+	qm.applyPauses(now)
+	return resumed
+}
+
+// INTERNAL: Removes the pauses whose target matches, returns the amount of removed pauses
+func (qm *QueueManager) removePauses(matches func(Target) bool) int {
+	removed := 0
+	pauses := qm.pauses[:0]
+	for _, pause := range qm.pauses {
+		if matches(pause.Target) {
+			removed++
+			continue
+		}
+		pauses = append(pauses, pause)
+	}
+	qm.pauses = pauses
+
+	return removed
+}
+
+/*
+INTERNAL:
+Drops pauses which are over and pauses the rate limit groups of all queues accordingly. Returns the amount of paused groups
+*/
+func (qm *QueueManager) applyPauses(now time.Time) int {
+	qm.prunePauses(now)
+
+	paused := 0
+	for _, queues := range qm.Queues {
+		for _, queue := range queues {
+			paused += qm.applyQueuePauses(queue, now)
+		}
+	}
+
+	return paused
+}
+
+// INTERNAL: Drops pauses which are over
+func (qm *QueueManager) prunePauses(now time.Time) {
+	pauses := qm.pauses[:0]
+	for _, pause := range qm.pauses {
+		if pause.Until.After(now) {
+			pauses = append(pauses, pause)
+		}
+	}
+	qm.pauses = pauses
+}
+
+// INTERNAL: Pauses the rate limit groups of a queue, returns the amount of paused groups
+func (qm *QueueManager) applyQueuePauses(rb *RingBuffer, now time.Time) int {
+	paused := 0
+	for i, group := range *rb.Limits {
+		group.PausedUntil = time.Time{}
+		for _, pause := range qm.pauses {
+			pause.Priority = ""
+			if pause.matchesQueue(rb) && pause.matchesKey(qm.opts.ApiKeys[i].Name) && pause.Until.After(group.PausedUntil) {
+				group.PausedUntil = pause.Until
+			}
+		}
+
+		if group.PausedUntil.After(now) {
+			paused++
+		}
+	}
+
+	return paused
+}
+
+/*
+INTERNAL:
+Returns when the earliest pause of the queue's keys is over, if every key is paused
+*/
+func (rb *RingBuffer) pausedUntil(now time.Time) (time.Time, bool) {
+	var until time.Time
+	for _, group := range *rb.Limits {
+		if !group.PausedUntil.After(now) {
+			return time.Time{}, false
+		}
+
+		if until.IsZero() || group.PausedUntil.Before(until) {
+			until = group.PausedUntil
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+/*
+Removes all requests from the targeted queues. They are answered with the given status and an optional Retry-After.
+Returns the amount of flushed requests. Has to be called from the main loop
+*/
+func (qm *QueueManager) Flush(target Target, status int, retryAfter *time.Time) int {
+	flushed := 0
+	for _, queues := range qm.Queues {
+		for _, queue := range queues {
+			if target.matchesQueue(queue) {
+				flushed += queue.flush(status, retryAfter)
+			}
+		}
+	}
+
+	return flushed
+}
+
+/*
+Discovers the limits of the targeted methods and keys again with their next request, instead of waiting for the update interval.
+Returns the amount of affected rate limit groups. Has to be called from the main loop
+*/
+func (qm *QueueManager) Rediscover(target Target, now time.Time) int {
+	rediscovered := 0
+
+	// Groups outlive their queues, which are cleaned up when they are empty, so they are matched by their route
+	routes := routesById()
+	for id, groups := range qm.RateLimitGroups {
+		for i, group := range *groups {
+			if group != nil && target.matchesRoute(group.Platform, routes[id].endpoint, routes[id].httpMethod) && target.matchesKey(qm.opts.ApiKeys[i].Name) {
+				group.LastUpdated = now.Add(-1 * (configs.RATELIMIT_UPDATE_INTERVAL + 1*time.Second))
+				rediscovered++
+			}
+		}
+	}
+
+	return rediscovered
+}
@@ -6,31 +6,6 @@ import (
 	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
 )
 
-/*
-INTERNAL:
-Dequeues a request from the RingBuffer.
-*/
-func (rb *RingBuffer) dequeue() *request.Request {
-	if rb.count == 0 {
-		return nil
-	}
-
-	req := rb.entries[rb.head]
-
-	// Set reference to nil. This should hopefully erase memory if object is not referenced elsewhere
-	rb.entries[rb.head] = nil
-
-	rb.head = (rb.head + 1) % rb.size
-	rb.count--
-
-	// Set last updated to check for potential drops
-	if rb.count == 0 {
-		rb.lastUpdated = time.Now()
-	}
-
-	return req
-}
-
 /*
 Dequeues the next available request from the RingBuffer that is not expired.
 */
@@ -38,8 +13,13 @@ func (rb *RingBuffer) Dequeue(now time.Time) *request.Request {
 	return rb.purgeAndDequeue(now)
 }
 
-func (rb *RingBuffer) Process(max int) {
+/*
+Dispatches up to max requests. Returns the key ids of tokens that were refunded,
+because the client abandoned the request while it was dispatched.
+*/
+func (rb *RingBuffer) Process(max int) []int {
 	now := time.Now()
+	var refunded []int
 
 	// Purge queues to reduce queue size
 	rb.purge(now)
@@ -55,16 +35,24 @@ func (rb *RingBuffer) Process(max int) {
 
 		if req == nil {
 			// This should not happen, but just in case
-			rb.Refund(keyId, now)
+			rb.Refund(keyId, now, now)
 			break
 		}
 
 		// Giving the request the corresponding key id
-		req.Response <- &request.ResponseChannel{
-			KeyId:  keyId,
-			Update: rb.needsUpdate(keyId, now),
+		delivered := req.Deliver(&request.ResponseChannel{
+			KeyId:     keyId,
+			Update:    rb.needsUpdate(keyId, now),
+			AllowedAt: now,
+		})
+
+		// The client left in between, the token was never used
+		if !delivered && rb.Refund(keyId, now, now) {
+			refunded = append(refunded, keyId)
 		}
 	}
+
+	return refunded
 }
 
 func (rb *RingBuffer) canDequeue(now time.Time) int {
@@ -72,7 +60,7 @@ func (rb *RingBuffer) canDequeue(now time.Time) int {
 
 	// Cycle through the key and check for one that allows the request
 	for i := 0; i < len(limits); i++ {
-		if limits[i].TryAllow(now, rb.Priority) {
+		if limits[i].TryAllow(now, rb.Class) {
 			return i
 		}
 	}
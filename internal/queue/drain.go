@@ -1,19 +1,37 @@
 package queue
 
+import "time"
+
 /*
 INTERNAL:
 Drains all entries from the RingBuffer. Then resets the buffer.
 This function has currently no use. I'm not sure if should get one, but it is here
 */
 func (rb *RingBuffer) drain() {
-	for rb.count > 0 {
-		entry := rb.dequeue()
-		// Send a failed to close the proxy
-		entry.FailedResponse(nil)
+	for _, l := range rb.lanes {
+		for l.count > 0 {
+			entry := rb.remove(l, false)
+			// Send a failed to close the proxy
+			entry.FailedResponse(nil)
+		}
 	}
 
 	// This is totally unnecessary but makes stuff more consistent
-	rb.head = 0
-	rb.tail = 0
 	rb.count = 0
 }
+
+/*
+INTERNAL:
+Removes all entries from the RingBuffer and answers them with the given status. Returns the amount of flushed entries
+*/
+func (rb *RingBuffer) flush(status int, retryAfter *time.Time) int {
+	flushed := 0
+	for _, l := range rb.lanes {
+		for l.count > 0 {
+			rb.remove(l, false).FlushedResponse(status, retryAfter)
+			flushed++
+		}
+	}
+
+	return flushed
+}
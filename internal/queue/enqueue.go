@@ -7,20 +7,29 @@ import (
 )
 
 /*
-Enqueues a request into the RingBuffer.
+Enqueues a request into the lane of its tenant.
 Returns a timestamp when the unsuccessful in order to notify when to try again
 */
 func (rb *RingBuffer) Enqueue(req *request.Request) *time.Time {
-	// Check if the ring buffer is full and nothing is purgable
-	// Get expires timestamp of oldest request, then it should be possible to queue new requests.
-	// TODO: thats probably a bad idea
+	// Check if the ring buffer or the lane of the tenant is full and nothing is purgable
+	// A slot frees up once the oldest request is dispatched or expires, whatever happens first
 	now := time.Now()
-	if rb.size == rb.count && rb.purge(now) == 0 {
-		entry := rb.peek()
+	if rb.full(req.Tenant) {
+		rb.purge(now)
+	}
+
+	if rb.full(req.Tenant) {
+		entry := rb.oldest()
+		if l, Ok := rb.lanes[req.Tenant]; Ok && l.count == l.size {
+			entry = l.peek()
+		}
 
 		// Technically it is impossible for the entry to be nil here, but just in case
 		if entry != nil {
 			tryAgain := time.UnixMilli(entry.Expire)
+			if dispatchAt, Ok := rb.EstimateDispatch(1, now); Ok && dispatchAt.Before(tryAgain) {
+				tryAgain = dispatchAt
+			}
 			return &tryAgain
 		}
 
@@ -30,11 +39,20 @@ func (rb *RingBuffer) Enqueue(req *request.Request) *time.Time {
 
 	}
 
-	// Enqueue new request at the tail, then progress tail
-	rb.entries[rb.tail] = req
-	rb.tail = (rb.tail + 1) % rb.size
+	// Enqueue new request at the tail of its lane
+	rb.lane(req.Tenant).push(req)
 	rb.count++
 
 	// nil is returned if the enqueue was successful
 	return nil
 }
+
+// INTERNAL: Returns whether the ring buffer or the lane of the tenant is full
+func (rb *RingBuffer) full(tenant string) bool {
+	if rb.count == rb.size {
+		return true
+	}
+
+	l, Ok := rb.lanes[tenant]
+	return Ok && l.count == l.size
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"time"
+)
+
+// Estimates further ahead than this are not worth computing, the request is rejected anyway
+const maxEstimate = 24 * time.Hour
+
+/*
+Estimates when the n-th next request of the queue is dispatched, from the limits of all keys, their current counts and locks.
+Returns false if the limits of any key are still placeholders, an estimate would be meaningless then
+*/
+func (rb *RingBuffer) EstimateDispatch(n int64, now time.Time) (time.Time, bool) {
+	for _, group := range *rb.Limits {
+		if !group.Known() {
+			return now, false
+		}
+	}
+
+	if rb.availableUntil(now, now) >= n {
+		return now, true
+	}
+
+	// Find an upper bound first, then search for the earliest time enough requests are allowed
+	low, high := time.Duration(0), time.Second
+	for rb.availableUntil(now, now.Add(high)) < n {
+		if high >= maxEstimate {
+			return now.Add(maxEstimate), true
+		}
+		low, high = high, 2*high
+	}
+
+	for high-low > time.Millisecond {
+		mid := low + (high-low)/2
+		if rb.availableUntil(now, now.Add(mid)) >= n {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+
+	return now.Add(high), true
+}
+
+// Amount of requests all keys allow from now until t
+func (rb *RingBuffer) availableUntil(now time.Time, t time.Time) int64 {
+	available := int64(0)
+	for _, group := range *rb.Limits {
+		available += group.AvailableUntil(now, t, rb.Class)
+	}
+
+	return available
+}
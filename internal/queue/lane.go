@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
+)
+
+/*
+The requests of one tenant within a RingBuffer, in order of arrival.
+Lanes are served by stride scheduling: the lane with the lowest pass is served next and each request advances its pass by 1/weight,
+so tenants get a share of the dispatched requests proportional to their weight
+*/
+type lane struct {
+	// Grows with the backlog of the tenant instead of reserving the size of the queue up front
+	entries []*request.Request
+	head    int
+	size    int64 // amount of requests the tenant may queue
+	count   int64
+
+	tenant string
+	weight float64
+	pass   float64
+}
+
+func (l *lane) push(req *request.Request) {
+	l.entries = append(l.entries, req)
+	l.count++
+}
+
+func (l *lane) pop() *request.Request {
+	req := l.entries[l.head]
+
+	// Set reference to nil. This should hopefully erase memory if object is not referenced elsewhere
+	l.entries[l.head] = nil
+
+	l.head++
+	l.count--
+
+	// Reuse the space in front of the head, once it makes up half of the lane
+	if l.count == 0 {
+		l.entries = l.entries[:0]
+		l.head = 0
+	} else if l.head >= len(l.entries)/2 {
+		n := copy(l.entries, l.entries[l.head:])
+		clear(l.entries[n:])
+		l.entries = l.entries[:n]
+		l.head = 0
+	}
+
+	return req
+}
+
+func (l *lane) peek() *request.Request {
+	if l.count == 0 {
+		return nil
+	}
+
+	return l.entries[l.head]
+}
+
+/*
+INTERNAL:
+Returns the lane of a tenant, creating it if it doesn't exist yet. New lanes start at the current pass,
+so a tenant can't save up turns while it has nothing queued.
+Lanes of tenants that emptied their queue are reused, so a queue which empties regularly doesn't allocate a new lane each time
+*/
+func (rb *RingBuffer) lane(tenant string) *lane {
+	if l, Ok := rb.lanes[tenant]; Ok {
+		return l
+	}
+
+	l := rb.spare
+	rb.spare = nil
+	if l == nil {
+		l = &lane{}
+	}
+
+	settings := rb.tenants.Tenant(tenant)
+	l.size = min(max(int64(float32(rb.size)*settings.QueueShare), 1), rb.size)
+	l.tenant = tenant
+	l.weight = settings.Weight
+	l.pass = rb.pass
+
+	rb.lanes[tenant] = l
+	return l
+}
+
+// INTERNAL: Returns the lane which is served next, nil if all lanes are empty
+func (rb *RingBuffer) next() *lane {
+	var next *lane
+	for _, l := range rb.lanes {
+		// Ties are broken by tenant, so the order doesn't depend on the map iteration
+		if next == nil || l.pass < next.pass || (l.pass == next.pass && l.tenant < next.tenant) {
+			next = l
+		}
+	}
+
+	return next
+}
+
+/*
+INTERNAL:
+Removes the head of a lane. Served requests advance the pass of their lane, expired or abandoned ones don't.
+Empty lanes are removed
+*/
+func (rb *RingBuffer) remove(l *lane, served bool) *request.Request {
+	req := l.pop()
+	rb.count--
+
+	// Set last updated to check for potential drops
+	if rb.count == 0 {
+		rb.lastUpdated = time.Now()
+	}
+
+	if served {
+		rb.pass = l.pass
+		l.pass += 1 / l.weight
+	}
+
+	if l.count == 0 {
+		delete(rb.lanes, l.tenant)
+		rb.spare = l
+	}
+
+	return req
+}
+
+/*
+INTERNAL:
+Estimates how many requests are dispatched before a new request of the tenant, if all lanes keep their current backlog.
+Without tenants, these are all requests in the queue
+*/
+func (rb *RingBuffer) ahead(tenant string) int64 {
+	own := int64(0)
+	weight := rb.tenants.Tenant(tenant).Weight
+	if l, Ok := rb.lanes[tenant]; Ok {
+		own = l.count
+	}
+
+	// Other lanes are served in proportion to their weight until the new request is up
+	turns := float64(own+1) / weight
+	ahead := own
+	for _, l := range rb.lanes {
+		if l.tenant != tenant {
+			ahead += min(l.count, int64(turns*l.weight))
+		}
+	}
+
+	return ahead
+}
+
+// Returns the amount of queued requests per tenant
+func (rb *RingBuffer) TenantCounts() map[string]int64 {
+	counts := make(map[string]int64, len(rb.lanes))
+	for tenant, l := range rb.lanes {
+		counts[tenant] = l.count
+	}
+
+	return counts
+}
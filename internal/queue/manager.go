@@ -2,6 +2,7 @@ package queue
 
 import (
 	"log"
+	"math"
 	"time"
 
 	"github.com/DarkIntaqt/cosmic-radiance/configs"
@@ -12,20 +13,24 @@ import (
 )
 
 type QueueManager struct {
-	Queues              map[string]*RingBuffer
-	PriorityQueues      map[string]*RingBuffer
+	Queues              []map[string]*RingBuffer                 // per priority class, by ID
 	RateLimitGroups     map[string]*resource.RateLimitGroupSlice // per ID, holds several api keys
 	RateLimitCategories []map[string]*resource.RateLimitCategory // for each api key, holds either platform or ID
+	pauses              []Pause                                  // paused by the admin API
 	opts                *options.RateLimiterOptions
+
+	maxTimeout       time.Duration     // longest time a request can wait, the queues are sized for it
+	appLimitSeeds    []string          // configured app limits per api key
+	methodLimitSeeds map[string]string // configured method limits by HTTP method, endpoint and platform
 }
 
 func NewQueueManager(opts *options.RateLimiterOptions) *QueueManager {
 	manager := &QueueManager{
-		Queues:              make(map[string]*RingBuffer),
-		PriorityQueues:      make(map[string]*RingBuffer),
+		Queues:              make([]map[string]*RingBuffer, len(opts.PriorityClasses)),
 		RateLimitGroups:     make(map[string]*resource.RateLimitGroupSlice),
 		RateLimitCategories: make([]map[string]*resource.RateLimitCategory, len(opts.ApiKeys)),
 		opts:                opts,
+		maxTimeout:          max(opts.Timeout, opts.MaxTimeout),
 	}
 
 	// Init the maps
@@ -33,13 +38,19 @@ func NewQueueManager(opts *options.RateLimiterOptions) *QueueManager {
 		manager.RateLimitCategories[i] = make(map[string]*resource.RateLimitCategory)
 	}
 
+	for i := range manager.Queues {
+		manager.Queues[i] = make(map[string]*RingBuffer)
+	}
+
+	manager.resolveSeeds()
+
 	return manager
 }
 
 /*
 Enqueues a request into the appropriate queue based on its priority.
 Creates queues with rate limits if they don't exist yet.
-Returns a timestamp when the request can be retried if the queue is full.
+Returns a timestamp when the request can be retried if the queue is full. Requests of paused methods are answered right away.
 */
 func (qm *QueueManager) EnqueueRequest(req *request.Request, priority request.Priority, syntax *schema.Syntax) *time.Time {
 	// Set the current queue
@@ -49,129 +60,211 @@ func (qm *QueueManager) EnqueueRequest(req *request.Request, priority request.Pr
 	if _, exists := queue[syntax.Id]; !exists {
 		// Create if the rate limit group doesn't already exists
 		if groups, exists := qm.RateLimitGroups[syntax.Id]; !exists || len(*groups) == 0 {
-			now := time.Now()
-
-			// Create the rate limit group and categories and fill it with placeholder limits
-			// A group will only exists if a category also already exists
-			rateLimitGroupSlice := make(resource.RateLimitGroupSlice, len(qm.opts.ApiKeys))
-			qm.RateLimitGroups[syntax.Id] = &rateLimitGroupSlice
-			created := 0
-
-			for i := 0; i < len(qm.opts.ApiKeys); i++ {
-				if _, Ok := qm.RateLimitCategories[i][syntax.Id]; !Ok {
-					created++
-					qm.RateLimitCategories[i][syntax.Id] = &resource.RateLimitCategory{
-						LockedUntil: now,
-						RateLimits: []*resource.RateLimit{{
-							Window:     5 * time.Second,
-							Limit:      5,
-							Current:    0,
-							LastRefill: now,
-						}},
-						AdditionalWindowSize: &qm.opts.AdditionalWindowSize,
-						Timeout:              &qm.opts.Timeout,
-					}
-				}
-
-				// Check if there are no limits for the platform already
-				if _, Ok := qm.RateLimitCategories[i][syntax.Platform]; !Ok {
-					created++
-					qm.RateLimitCategories[i][syntax.Platform] = &resource.RateLimitCategory{
-						LockedUntil: now,
-						RateLimits: []*resource.RateLimit{{
-							Window:     5 * time.Second,
-							Limit:      5,
-							Current:    0,
-							LastRefill: now,
-						}},
-						AdditionalWindowSize: &qm.opts.AdditionalWindowSize,
-						Timeout:              &qm.opts.Timeout,
-					}
-				}
-
-				platformLimits := qm.RateLimitCategories[i][syntax.Platform]
-				methodLimits := qm.RateLimitCategories[i][syntax.Id]
-
-				(*qm.RateLimitGroups[syntax.Id])[i] = &resource.RateLimitGroup{
-					KeyId: i,
-					// Instantly trigger an update by setting lastUpdated to the past
-					LastUpdated:    now.Add(-1 * (configs.RATELIMIT_UPDATE_INTERVAL + 1*time.Second)),
-					PlatformLimits: platformLimits,
-					MethodLimits:   methodLimits,
-					// Set peak capacity to something that smaller...
-					PeakCapacity: int64(50 * qm.opts.Timeout.Seconds() / float64(i+1)),
-				}
-			}
+			qm.newRateLimitGroups(syntax.Id, syntax.Platform, qm.methodLimitSeed(syntax), time.Now())
 		}
 
 		groups := qm.RateLimitGroups[syntax.Id]
-		queue[syntax.Id] = newRingBuffer(groups, priority, qm.opts.PriorityQueueSize)
-		if priority == request.HighPriority {
-			log.Printf("Queue #P-%s created for %s/%s with size of %d\n", syntax.Id, syntax.Platform, syntax.Endpoint, queue[syntax.Id].size)
-		} else {
-			log.Printf("Queue #%s created for %s/%s with size of %d\n", syntax.Id, syntax.Platform, syntax.Endpoint, queue[syntax.Id].size)
-		}
+
+		// The requested method contains parameters, only keep the route
+		route := *syntax
+		route.Method = syntax.Endpoint
+
+		class := qm.opts.PriorityClasses[priority]
+		queue[syntax.Id] = newRingBuffer(groups, route, priority, class, &qm.opts.Tenants)
+		log.Printf("Queue #%s created for %s/%s (%s) with size of %d\n", syntax.Id, syntax.Platform, syntax.Endpoint, class.Name, queue[syntax.Id].size)
+
+		// The method or key might have been paused before the queue existed
+		qm.applyQueuePauses(queue[syntax.Id], time.Now())
+	}
+
+	// The estimate would point at the end of the pause, which might be never. Clients retry shortly instead
+	now := time.Now()
+	if pausedUntil, Ok := queue[syntax.Id].pausedUntil(now); Ok {
+		tryAgain := now.Add(min(pausedUntil.Sub(now), configs.PAUSED_RETRY_AFTER))
+		req.PausedResponse(&tryAgain)
+		return nil
+	}
+
+	// Reject requests right away which would expire before the queue ahead of them is processed
+	if tryAgain := qm.admit(queue[syntax.Id], req, priority, syntax, now); tryAgain != nil {
+		return tryAgain
 	}
 
 	// Enqueue the request into the right queue
 	return queue[syntax.Id].Enqueue(req)
 }
 
-func (qm *QueueManager) getQueues(priority request.Priority) map[string]*RingBuffer {
-	// Set the current queue
-	queue := qm.Queues
-	if priority == request.HighPriority {
-		queue = qm.PriorityQueues
+/*
+INTERNAL:
+Estimates when the request would be dispatched, given the requests ahead of it and the limits of all keys.
+Requests also wait for the queues of higher priority classes of the method, as they are processed first.
+Within its own queue, a request only waits for the share of other tenants that is served before it.
+Returns when the request could be served before its deadline, if it can't.
+Falls back to the peak capacity until the limits are known
+*/
+func (qm *QueueManager) admit(rb *RingBuffer, req *request.Request, priority request.Priority, syntax *schema.Syntax, now time.Time) *time.Time {
+	ahead := rb.ahead(req.Tenant)
+	for i := 0; i < int(priority); i++ {
+		if queue, Ok := qm.Queues[i][syntax.Id]; Ok {
+			ahead += queue.Count()
+		}
+	}
+
+	dispatchAt, Ok := rb.EstimateDispatch(ahead+1, now)
+	if !Ok {
+		req.EstimatedWait = -1
+		return qm.exceedsDeadline(rb, req, now)
+	}
+
+	deadline := time.UnixMilli(req.Expire)
+	if dispatchAt.After(deadline) {
+		// A retry with the same timeout fits once the requests ahead are processed
+		tryAgain := now.Add(dispatchAt.Sub(deadline))
+		return &tryAgain
+	}
+
+	req.EstimatedWait = dispatchAt.Sub(now)
+	return nil
+}
+
+/*
+INTERNAL:
+The peak capacity is the amount of requests that can be processed within the longest timeout.
+A request with a shorter deadline only fits a proportional part of the queue. Returns when the queue will be short enough, if it doesn't fit
+*/
+func (qm *QueueManager) exceedsDeadline(rb *RingBuffer, req *request.Request, now time.Time) *time.Time {
+	remaining := time.UnixMilli(req.Expire).Sub(now)
+	peakCapacity := rb.GetPeakCapacity()
+	if remaining >= qm.maxTimeout || peakCapacity <= 0 {
+		return nil
+	}
+
+	capacity := int64(float64(peakCapacity) * remaining.Seconds() / qm.maxTimeout.Seconds())
+	if rb.Count() < capacity {
+		return nil
+	}
+
+	// Time until enough requests ahead are processed
+	excess := float64(rb.Count() - capacity + 1)
+	tryAgain := now.Add(time.Duration(excess / float64(peakCapacity) * float64(qm.maxTimeout)))
+	return &tryAgain
+}
+
+/*
+INTERNAL:
+Creates the rate limit groups of a method for every key and fills them with the seeded or placeholder limits.
+Categories which already exist, e.g. the platform limits of another method, are reused.
+*/
+func (qm *QueueManager) newRateLimitGroups(id string, platform string, methodLimitSeed string, now time.Time) {
+	// Create the rate limit group and categories and fill it with placeholder limits
+	// A group will only exists if a category also already exists
+	rateLimitGroupSlice := make(resource.RateLimitGroupSlice, len(qm.opts.ApiKeys))
+	qm.RateLimitGroups[id] = &rateLimitGroupSlice
+	serviceBackoff := &resource.ServiceBackoff{}
+
+	for i := 0; i < len(qm.opts.ApiKeys); i++ {
+		if _, Ok := qm.RateLimitCategories[i][id]; !Ok {
+			qm.RateLimitCategories[i][id] = qm.newSeededCategory(methodLimitSeed, now)
+		}
+
+		// Check if there are no limits for the platform already
+		if _, Ok := qm.RateLimitCategories[i][platform]; !Ok {
+			qm.RateLimitCategories[i][platform] = qm.newSeededCategory(qm.appLimitSeeds[i], now)
+		}
+
+		platformLimits := qm.RateLimitCategories[i][platform]
+		methodLimits := qm.RateLimitCategories[i][id]
+
+		group := &resource.RateLimitGroup{
+			KeyId:    i,
+			Platform: platform,
+			// Instantly trigger an update by setting lastUpdated to the past
+			LastUpdated:    now.Add(-1 * (configs.RATELIMIT_UPDATE_INTERVAL + 1*time.Second)),
+			PlatformLimits: platformLimits,
+			MethodLimits:   methodLimits,
+			ServiceBackoff: serviceBackoff,
+			// Set peak capacity to something that smaller...
+			PeakCapacity: int64(50 * qm.maxTimeout.Seconds() / float64(i+1)),
+		}
+
+		// Known limits allow sizing the queue right away, the same way an update does
+		if qm.appLimitSeeds[i] != "" && methodLimitSeed != "" {
+			peakCapacity := math.Min(platformLimits.PeakCapacity(), methodLimits.PeakCapacity())
+			group.PeakCapacity = int64((peakCapacity + 1) * 1.05)
+		}
+
+		(*qm.RateLimitGroups[id])[i] = group
 	}
+}
 
-	return queue
+func (qm *QueueManager) newPlaceholderCategory(now time.Time) *resource.RateLimitCategory {
+	return &resource.RateLimitCategory{
+		LockedUntil: now,
+		RateLimits: []*resource.RateLimit{{
+			Window:     5 * time.Second,
+			Limit:      5,
+			Current:    0,
+			LastRefill: now,
+		}},
+		AdditionalWindowSize: &qm.opts.AdditionalWindowSize,
+		Timeout:              &qm.maxTimeout,
+		Placeholder:          true,
+	}
+}
+
+func (qm *QueueManager) getQueues(priority request.Priority) map[string]*RingBuffer {
+	return qm.Queues[priority]
 }
 
 func (qm *QueueManager) GetQueue(syntax schema.Syntax, priority request.Priority) *RingBuffer {
 	return qm.getQueues(priority)[syntax.Id]
 }
 
-func (qm *QueueManager) Drain() {
-	for _, queue := range qm.Queues {
-		queue.drain()
+/*
+Refunds a rate limit token of a key, e.g. if the request never reached Riot.
+Returns whether any limit was decreased.
+*/
+func (qm *QueueManager) Refund(id string, keyId int, allowedAt time.Time) bool {
+	groups, Ok := qm.RateLimitGroups[id]
+	if !Ok || keyId < 0 || keyId >= len(*groups) {
+		return false
 	}
-	for _, queue := range qm.PriorityQueues {
-		queue.drain()
+
+	return (*groups)[keyId].Refund(allowedAt, time.Now())
+}
+
+func (qm *QueueManager) Drain() {
+	for _, queues := range qm.Queues {
+		for _, queue := range queues {
+			queue.drain()
+		}
 	}
 }
 
 func (qm *QueueManager) AdjustQueueSize() {
 	now := time.Now()
-	for key, queue := range qm.getQueues(request.NormalPriority) {
-		peakCapacity := queue.GetPeakCapacity()
-		if peakCapacity != queue.size && queue.Count() < peakCapacity {
-			newQueue := newRingBuffer(queue.Limits, queue.Priority, qm.opts.PriorityQueueSize)
-
-			// put all entries from the old queue in the new queue
-			for queue.Count() > 0 {
-				newQueue.Enqueue(queue.Dequeue(now))
-			}
+	for _, queues := range qm.Queues {
+		for key, queue := range queues {
+			size := queue.targetSize()
+			if size != queue.size && queue.Count() < size {
+				newQueue := newRingBuffer(queue.Limits, queue.Syntax, queue.Priority, queue.Class, queue.tenants)
 
-			log.Printf("Queue #%s adjusted size from %d to %d\n", key, queue.size, newQueue.size)
-			go queue.drain()
-			qm.Queues[key] = newQueue
-		}
-	}
+				// put all entries from the old queue in the new queue, the lane of a tenant may have shrunk
+				for queue.Count() > 0 {
+					req := queue.Dequeue(now)
+					if req == nil {
+						break
+					}
 
-	for key, queue := range qm.getQueues(request.HighPriority) {
-		// Priority queues only get a fraction an original queues size to prevent overflows and priority spamming
-		peakCapacity := int64(float32(queue.GetPeakCapacity())*qm.opts.PriorityQueueSize) + 1
-		if peakCapacity != queue.size && queue.Count() < peakCapacity {
-			newQueue := newRingBuffer(queue.Limits, queue.Priority, qm.opts.PriorityQueueSize)
+					if tryAgain := newQueue.Enqueue(req); tryAgain != nil {
+						req.FailedResponse(tryAgain)
+					}
+				}
 
-			// put all entries from the old queue in the new queue
-			for queue.Count() > 0 {
-				newQueue.Enqueue(queue.Dequeue(now))
+				log.Printf("Queue #%s (%s) adjusted size from %d to %d\n", key, queue.Class.Name, queue.size, newQueue.size)
+				go queue.drain()
+				queues[key] = newQueue
 			}
-
-			log.Printf("Queue #P-%s adjusted size from %d to %d\n", key, queue.size, newQueue.size)
-			go queue.drain()
-			qm.PriorityQueues[key] = newQueue
 		}
 	}
 }
@@ -179,21 +272,14 @@ func (qm *QueueManager) AdjustQueueSize() {
 func (qm *QueueManager) CleanUp() {
 	now := time.Now()
 
-	for key, queue := range qm.getQueues(request.NormalPriority) {
-		if queue.Count() == 0 && queue.lastUpdated.Before(now.Add(-configs.QUEUE_INACTIVITY)) {
-			// If the queue is empty and hasn't been updated in a while, we can remove it
-			log.Printf("Queue #%s removed due to inactivity\n", key)
-			qm.Queues[key].drain()
-			delete(qm.Queues, key)
-		}
-	}
-	for key, queue := range qm.getQueues(request.HighPriority) {
-		if queue.Count() == 0 && queue.lastUpdated.Before(now.Add(-configs.QUEUE_INACTIVITY)) {
-			// If the queue is empty and hasn't been updated in a while, we can remove it
-			log.Printf("Queue #P-%s removed due to inactivity\n", key)
-			qm.PriorityQueues[key].drain()
-			delete(qm.PriorityQueues, key)
+	for _, queues := range qm.Queues {
+		for key, queue := range queues {
+			if queue.Count() == 0 && queue.lastUpdated.Before(now.Add(-configs.QUEUE_INACTIVITY)) {
+				// If the queue is empty and hasn't been updated in a while, we can remove it
+				log.Printf("Queue #%s (%s) removed due to inactivity\n", key, queue.Class.Name)
+				queue.drain()
+				delete(queues, key)
+			}
 		}
 	}
-
 }
@@ -8,14 +8,40 @@ import (
 
 // peek into the next request
 func (rb *RingBuffer) peek() *request.Request {
-	if rb.count == 0 {
+	l := rb.next()
+	if l == nil {
 		return nil
 	}
 
-	return rb.entries[rb.head]
+	return l.peek()
+}
+
+// oldest returns the request with the earliest expiration among the heads of all lanes
+func (rb *RingBuffer) oldest() *request.Request {
+	var oldest *request.Request
+	for _, l := range rb.lanes {
+		if req := l.peek(); req != nil && (oldest == nil || req.Expire < oldest.Expire) {
+			oldest = req
+		}
+	}
+
+	return oldest
 }
 
 // Peek returns the next valid request without removing it from the RingBuffer.
 func (rb *RingBuffer) Peek(now time.Time) *request.Request {
 	return rb.purgeAndPeek(now)
 }
+
+// oldestAge returns how long the oldest request is queued, 0 if the RingBuffer is empty
+func (rb *RingBuffer) oldestAge(now time.Time) time.Duration {
+	age := time.Duration(0)
+	for _, l := range rb.lanes {
+		// Lanes are in order of arrival, so the head is the oldest request of the lane
+		if req := l.peek(); req != nil {
+			age = max(age, now.Sub(time.UnixMilli(req.Created)))
+		}
+	}
+
+	return age
+}
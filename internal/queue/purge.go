@@ -8,25 +8,25 @@ import (
 
 // NOT TO BE CONFUSED WITH DRAIN!
 
-// purge removes all outdated entries by peeking into them, then return amount of purged entries
+// purge removes all outdated entries by peeking into each lane, then return amount of purged entries
 func (rb *RingBuffer) purge(nowTime time.Time) int {
 	now := nowTime.UnixMilli()
 	retry := nowTime.Add(1 * time.Second)
 	count := 0
 
-	for {
-		req := rb.peek()
-		if req == nil {
-			return count
-		}
+	for _, l := range rb.lanes {
+		for {
+			req := l.peek()
+			if req == nil || now < req.Expire {
+				break
+			}
 
-		if now < req.Expire {
-			return count
+			count++
+			rb.remove(l, false).FailedResponse(&retry)
 		}
-
-		count++
-		rb.dequeue().FailedResponse(&retry)
 	}
+
+	return count
 }
 
 // purgeAndPeek removes all outdated entries and returns the next valid request.
@@ -35,16 +35,16 @@ func (rb *RingBuffer) purgeAndPeek(nowTime time.Time) *request.Request {
 	retry := nowTime.Add(1 * time.Second)
 
 	for {
-		req := rb.peek()
-		if req == nil {
+		l := rb.next()
+		if l == nil {
 			return nil
 		}
 
-		if now < req.Expire {
+		if req := l.peek(); now < req.Expire {
 			return req
 		}
 
-		rb.dequeue().FailedResponse(&retry)
+		rb.remove(l, false).FailedResponse(&retry)
 	}
 }
 
@@ -54,18 +54,21 @@ func (rb *RingBuffer) purgeAndDequeue(nowTime time.Time) *request.Request {
 	retry := nowTime.Add(1 * time.Second)
 
 	for {
-		req := rb.dequeue()
-		if req == nil {
+		l := rb.next()
+		if l == nil {
 			return nil
 		}
-		if req.Invalidated {
+
+		req := l.peek()
+		if req.Invalidated() {
+			rb.remove(l, false)
 			continue
 		}
 
 		if now < req.Expire {
-			return req
+			return rb.remove(l, true)
 		} else {
-			req.FailedResponse(&retry)
+			rb.remove(l, false).FailedResponse(&retry)
 		}
 	}
 }
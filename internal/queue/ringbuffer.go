@@ -5,45 +5,49 @@ import (
 
 	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/resource"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 )
 
 // This ring buffer should be atomic. It can only be read by the main thread.
 // There is no need to lock the design
 // Dequeued *request.Request pointers should be set to nil in order to GC them
+// Each tenant has its own lane, without tenants all requests share a single lane
 
 type RingBuffer struct {
-	entries []*request.Request
-	size    int64
-	// Pointing to the boundaries of the queue
-	head, tail int64
-	// Size of the queue
+	lanes map[string]*lane // by tenant
+	spare *lane            // last emptied lane, reused by the next tenant
+	size  int64
+	// Amount of requests in all lanes
 	count int64
+	// Pass of the last served lane
+	pass    float64
+	tenants *options.TenantOptions
 	// Current unused
 	lastUpdated time.Time
 	Priority    request.Priority
+	Class       options.PriorityClass
 
 	// List of rate limits. One group per API key
 	Limits *resource.RateLimitGroupSlice
+
+	// Route of the queue, used as metrics labels
+	Syntax schema.Syntax
 }
 
-func newRingBuffer(limits *resource.RateLimitGroupSlice, priority request.Priority, priorityQueueSize float32) *RingBuffer {
+func newRingBuffer(limits *resource.RateLimitGroupSlice, syntax schema.Syntax, priority request.Priority, class options.PriorityClass, tenants *options.TenantOptions) *RingBuffer {
 	buffer := &RingBuffer{
-		head:        0,
-		tail:        0,
+		lanes:       make(map[string]*lane),
 		count:       0,
+		tenants:     tenants,
 		lastUpdated: time.Now(),
 		Priority:    priority,
+		Class:       class,
 		Limits:      limits,
+		Syntax:      syntax,
 	}
 
-	size := buffer.GetPeakCapacity()
-
-	if priority == request.HighPriority {
-		size = int64(float32(buffer.GetPeakCapacity())*priorityQueueSize) + 1
-	}
-
-	buffer.entries = make([]*request.Request, size)
-	buffer.size = size
+	buffer.size = buffer.targetSize()
 
 	return buffer
 }
@@ -52,10 +56,10 @@ func (rb *RingBuffer) Count() int64 {
 	return rb.count
 }
 
-func (rb *RingBuffer) Refund(keyId int, timestamp time.Time) {
+func (rb *RingBuffer) Refund(keyId int, allowedAt time.Time, now time.Time) bool {
 	limits := *rb.Limits
 	if keyId < 0 || keyId >= len(limits) {
-		return
+		return false
 	}
-	limits[keyId].Refund(timestamp)
+	return limits[keyId].Refund(allowedAt, now)
 }
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/resource"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// Applies to all keys or platforms in RateLimitSeeds
+const seedWildcard = "*"
+
+/*
+INTERNAL:
+Resolves the configured seeds to the keys and methods they apply to. Panics on malformed limits, like all other invalid options
+*/
+func (qm *QueueManager) resolveSeeds() {
+	seeds := qm.opts.RateLimitSeeds
+	now := time.Now()
+
+	qm.appLimitSeeds = make([]string, len(qm.opts.ApiKeys))
+	for i, key := range qm.opts.ApiKeys {
+		limit, Ok := seeds.AppLimits[key.Name]
+		if !Ok {
+			limit = seeds.AppLimits[seedWildcard]
+		}
+
+		if limit == "" {
+			continue
+		}
+
+		if _, err := resource.ParseRateLimits(limit, qm.opts.AdditionalWindowSize, now); err != nil {
+			panic("Invalid app rate limit for " + key.Name + ": " + err.Error())
+		}
+		qm.appLimitSeeds[i] = limit
+	}
+
+	qm.methodLimitSeeds = make(map[string]string)
+	for endpoint, platforms := range seeds.MethodLimits {
+		httpMethod := http.MethodGet
+		if split := strings.SplitN(strings.TrimSpace(endpoint), " ", 2); len(split) == 2 {
+			httpMethod = strings.ToUpper(split[0])
+			endpoint = split[1]
+		}
+		endpoint = strings.TrimPrefix(strings.TrimSpace(endpoint), "/")
+
+		for platform, limit := range platforms {
+			if _, err := resource.ParseRateLimits(limit, qm.opts.AdditionalWindowSize, now); err != nil {
+				panic("Invalid method rate limit for " + endpoint + ": " + err.Error())
+			}
+			qm.methodLimitSeeds[seedKey(httpMethod, endpoint, platform)] = limit
+		}
+	}
+}
+
+// Returns the seeded method limit of a request, an empty string if there is none
+func (qm *QueueManager) methodLimitSeed(syntax *schema.Syntax) string {
+	if limit, Ok := qm.methodLimitSeeds[seedKey(syntax.HttpMethod, syntax.Endpoint, syntax.Platform)]; Ok {
+		return limit
+	}
+
+	return qm.methodLimitSeeds[seedKey(syntax.HttpMethod, syntax.Endpoint, seedWildcard)]
+}
+
+func seedKey(httpMethod string, endpoint string, platform string) string {
+	return httpMethod + " " + endpoint + "@" + platform
+}
+
+/*
+INTERNAL:
+Creates a category with the seeded limits, or placeholder limits if nothing is seeded
+*/
+func (qm *QueueManager) newSeededCategory(limit string, now time.Time) *resource.RateLimitCategory {
+	category := qm.newPlaceholderCategory(now)
+
+	if limit != "" {
+		// The seeds are validated upfront
+		if rateLimits, err := resource.ParseRateLimits(limit, qm.opts.AdditionalWindowSize, now); err == nil {
+			category.RateLimits = rateLimits
+			category.Placeholder = false
+		}
+	}
+
+	return category
+}
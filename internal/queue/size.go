@@ -5,6 +5,11 @@ func (rb *RingBuffer) Size() int64 {
 	return rb.size
 }
 
+// Size the queue should have. Each priority class gets its share of the peak capacity, lower shares prevent overflows and priority spamming
+func (rb *RingBuffer) targetSize() int64 {
+	return max(int64(float32(rb.GetPeakCapacity())*rb.Class.QueueShare), 1)
+}
+
 func (rb *RingBuffer) GetPeakCapacity() int64 {
 	peakCapacity := int64(0)
 	for _, group := range *rb.Limits {
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/resource"
+)
+
+// Persisted rate limit state, so a restart doesn't need to discover all limits again
+type Snapshot struct {
+	CreatedAt time.Time               `json:"createdAt"`
+	Keys      map[string]*KeySnapshot `json:"keys"` // by fingerprint of the api key
+}
+
+type KeySnapshot struct {
+	Categories map[string]*CategorySnapshot `json:"categories"` // by platform or method id
+	Groups     map[string]*GroupSnapshot    `json:"groups"`     // by method id
+}
+
+type CategorySnapshot struct {
+	LockedUntil time.Time            `json:"lockedUntil"`
+	RateLimits  []resource.RateLimit `json:"rateLimits"`
+}
+
+type GroupSnapshot struct {
+	Platform     string    `json:"platform"`
+	PeakCapacity int64     `json:"peakCapacity"`
+	LastUpdated  time.Time `json:"lastUpdated"`
+}
+
+/*
+Copies the current rate limit state of all keys. Has to be called from the main loop.
+*/
+func (qm *QueueManager) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		CreatedAt: time.Now(),
+		Keys:      make(map[string]*KeySnapshot, len(qm.opts.ApiKeys)),
+	}
+
+	for i, key := range qm.opts.ApiKeys {
+		keySnapshot := &KeySnapshot{
+			Categories: make(map[string]*CategorySnapshot),
+			Groups:     make(map[string]*GroupSnapshot),
+		}
+
+		for name, category := range qm.RateLimitCategories[i] {
+			// Guessed limits are discovered again anyway
+			if category.Placeholder {
+				continue
+			}
+
+			rateLimits := make([]resource.RateLimit, len(category.RateLimits))
+			for j, limit := range category.RateLimits {
+				rateLimits[j] = *limit
+			}
+
+			keySnapshot.Categories[name] = &CategorySnapshot{
+				LockedUntil: category.LockedUntil,
+				RateLimits:  rateLimits,
+			}
+		}
+
+		for id, groups := range qm.RateLimitGroups {
+			if i >= len(*groups) || (*groups)[i] == nil {
+				continue
+			}
+
+			group := (*groups)[i]
+			keySnapshot.Groups[id] = &GroupSnapshot{
+				Platform:     group.Platform,
+				PeakCapacity: group.PeakCapacity,
+				LastUpdated:  group.LastUpdated,
+			}
+		}
+
+		snapshot.Keys[keyFingerprint(key.ApiKey)] = keySnapshot
+	}
+
+	return snapshot
+}
+
+/*
+Restores the rate limit state of all keys found in the snapshot. Keys which are not part of the snapshot keep their placeholder limits.
+Has to be called before any request is enqueued.
+*/
+func (qm *QueueManager) Restore(snapshot *Snapshot) int {
+	now := time.Now()
+	restored := 0
+
+	for i, key := range qm.opts.ApiKeys {
+		keySnapshot, Ok := snapshot.Keys[keyFingerprint(key.ApiKey)]
+		if !Ok {
+			continue
+		}
+		restored++
+
+		for name, categorySnapshot := range keySnapshot.Categories {
+			if len(categorySnapshot.RateLimits) == 0 {
+				continue
+			}
+
+			rateLimits := make([]*resource.RateLimit, len(categorySnapshot.RateLimits))
+			for j := range categorySnapshot.RateLimits {
+				limit := categorySnapshot.RateLimits[j]
+				rateLimits[j] = &limit
+			}
+
+			qm.RateLimitCategories[i][name] = &resource.RateLimitCategory{
+				LockedUntil:          categorySnapshot.LockedUntil,
+				RateLimits:           rateLimits,
+				AdditionalWindowSize: &qm.opts.AdditionalWindowSize,
+				Timeout:              &qm.maxTimeout,
+			}
+		}
+	}
+
+	// Groups are created for every key, the restored categories are picked up automatically
+	for i, key := range qm.opts.ApiKeys {
+		keySnapshot, Ok := snapshot.Keys[keyFingerprint(key.ApiKey)]
+		if !Ok {
+			continue
+		}
+
+		for id, groupSnapshot := range keySnapshot.Groups {
+			if groupSnapshot.Platform == "" {
+				continue
+			}
+
+			if _, exists := qm.RateLimitGroups[id]; !exists {
+				qm.newRateLimitGroups(id, groupSnapshot.Platform, "", now)
+			}
+
+			group := (*qm.RateLimitGroups[id])[i]
+			if groupSnapshot.PeakCapacity > 0 {
+				group.PeakCapacity = groupSnapshot.PeakCapacity
+			}
+			group.LastUpdated = groupSnapshot.LastUpdated
+		}
+	}
+
+	return restored
+}
+
+// Identifies an api key in a snapshot without writing the key itself to disk
+func keyFingerprint(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return fmt.Sprintf("%x", hash[:8])
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/resource"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// Live rate limit and queue state, as reported by the admin API
+type State struct {
+	CreatedAt time.Time     `json:"createdAt"`
+	Keys      []*KeyState   `json:"keys"`
+	Queues    []*QueueState `json:"queues"`
+	Pauses    []Pause       `json:"pauses"`
+}
+
+type KeyState struct {
+	Name   string        `json:"name"`
+	Groups []*GroupState `json:"groups"` // one per method and platform
+}
+
+type GroupState struct {
+	Id                 string         `json:"id"`
+	Platform           string         `json:"platform"`
+	Endpoint           string         `json:"endpoint"`
+	HttpMethod         string         `json:"httpMethod"`
+	PeakCapacity       int64          `json:"peakCapacity"`
+	LastUpdated        time.Time      `json:"lastUpdated"`
+	ServiceLockedUntil time.Time      `json:"serviceLockedUntil"`
+	PausedUntil        time.Time      `json:"pausedUntil"`
+	App                *CategoryState `json:"app"`
+	Method             *CategoryState `json:"method"`
+}
+
+type CategoryState struct {
+	LockedUntil time.Time    `json:"lockedUntil"`
+	Placeholder bool         `json:"placeholder"` // the limits are a guess until Riot reports them
+	Limits      []LimitState `json:"limits"`
+}
+
+type LimitState struct {
+	Limit      int       `json:"limit"`
+	Window     float64   `json:"window"` // in seconds, including the additional window size
+	Current    int       `json:"current"`
+	LastRefill time.Time `json:"lastRefill"`
+	RefillIn   float64   `json:"refillIn"` // seconds until the window is over, 0 if it is already
+}
+
+type QueueState struct {
+	Id         string           `json:"id"`
+	Platform   string           `json:"platform"`
+	Endpoint   string           `json:"endpoint"`
+	HttpMethod string           `json:"httpMethod"`
+	Priority   string           `json:"priority"`
+	Size       int64            `json:"size"`
+	Count      int64            `json:"count"`
+	OldestAge  float64          `json:"oldestAge"` // seconds the oldest queued request is waiting, 0 if the queue is empty
+	Tenants    map[string]int64 `json:"tenants,omitempty"`
+}
+
+type route struct{ endpoint, httpMethod string }
+
+// INTERNAL: Groups only know their method id, the route table knows the endpoint
+func routesById() map[string]route {
+	routes := make(map[string]route)
+	for _, methods := range schema.AllowedPattern() {
+		for _, endpoint := range methods {
+			routes[endpoint.Id] = route{endpoint.Method, endpoint.HttpMethod}
+		}
+	}
+
+	return routes
+}
+
+/*
+Copies the current rate limit and queue state of all keys. Has to be called from the main loop.
+*/
+func (qm *QueueManager) State(now time.Time) *State {
+	// Pauses which are over are otherwise only dropped by the next operation
+	qm.prunePauses(now)
+
+	state := &State{
+		CreatedAt: now,
+		Keys:      make([]*KeyState, len(qm.opts.ApiKeys)),
+		Queues:    []*QueueState{},
+		Pauses:    append([]Pause{}, qm.pauses...),
+	}
+
+	routes := routesById()
+
+	for i, key := range qm.opts.ApiKeys {
+		state.Keys[i] = &KeyState{
+			Name:   key.Name,
+			Groups: []*GroupState{},
+		}
+	}
+
+	for id, groups := range qm.RateLimitGroups {
+		for i, group := range *groups {
+			if group == nil {
+				continue
+			}
+
+			groupState := &GroupState{
+				Id:           id,
+				Platform:     group.Platform,
+				Endpoint:     routes[id].endpoint,
+				HttpMethod:   routes[id].httpMethod,
+				PeakCapacity: group.PeakCapacity,
+				LastUpdated:  group.LastUpdated,
+				PausedUntil:  group.PausedUntil,
+				App:          categoryState(group.PlatformLimits, now),
+				Method:       categoryState(group.MethodLimits, now),
+			}
+			if group.ServiceBackoff != nil {
+				groupState.ServiceLockedUntil = group.ServiceBackoff.LockedUntil
+			}
+
+			state.Keys[i].Groups = append(state.Keys[i].Groups, groupState)
+		}
+	}
+
+	for priority, queues := range qm.Queues {
+		for id, queue := range queues {
+			queueState := &QueueState{
+				Id:         id,
+				Platform:   queue.Syntax.Platform,
+				Endpoint:   queue.Syntax.Endpoint,
+				HttpMethod: queue.Syntax.HttpMethod,
+				Priority:   qm.opts.PriorityClasses[priority].Name,
+				Size:       queue.Size(),
+				Count:      queue.Count(),
+				OldestAge:  queue.oldestAge(now).Seconds(),
+			}
+
+			if qm.opts.TenantsEnabled() {
+				queueState.Tenants = queue.TenantCounts()
+			}
+
+			state.Queues = append(state.Queues, queueState)
+		}
+	}
+
+	return state
+}
+
+func categoryState(category *resource.RateLimitCategory, now time.Time) *CategoryState {
+	state := &CategoryState{
+		LockedUntil: category.LockedUntil,
+		Placeholder: category.Placeholder,
+		Limits:      make([]LimitState, len(category.RateLimits)),
+	}
+
+	for i, limit := range category.RateLimits {
+		state.Limits[i] = LimitState{
+			Limit:      limit.Limit,
+			Window:     limit.Window.Seconds(),
+			Current:    limit.Current,
+			LastRefill: limit.LastRefill,
+			RefillIn:   max(limit.LastRefill.Add(limit.Window).Sub(now), 0).Seconds(),
+		}
+	}
+
+	return state
+}
+
+/*
+Reports for every key whether its app limits are locked or it is paused on every platform it was used for.
+Keys which weren't used yet aren't locked
+*/
+func (qm *QueueManager) LockedKeys(now time.Time) []bool {
+	locked := make([]bool, len(qm.opts.ApiKeys))
+	used := make([]bool, len(qm.opts.ApiKeys))
+	for keyId := range locked {
+		locked[keyId] = true
+	}
+
+	for _, groups := range qm.RateLimitGroups {
+		for keyId, group := range *groups {
+			if group == nil {
+				continue
+			}
+
+			used[keyId] = true
+			if !group.PlatformLimits.LockedUntil.After(now) && !group.PausedUntil.After(now) {
+				locked[keyId] = false
+			}
+		}
+	}
+
+	for keyId := range locked {
+		locked[keyId] = locked[keyId] && used[keyId]
+	}
+
+	return locked
+}
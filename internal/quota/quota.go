@@ -0,0 +1,229 @@
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+// Scopes of a tenant quota
+const (
+	ScopeAll      = ""
+	ScopePlatform = "platform"
+	ScopeMethod   = "method"
+)
+
+// Buckets whose windows are all over are removed in this interval
+const sweepInterval = time.Minute
+
+type limit struct {
+	limit  int
+	window time.Duration
+}
+
+// A window of a quota starts with its first request, like the windows of Riot's rate limits
+type window struct {
+	limit
+	current int
+	start   time.Time
+}
+
+/*
+Token budgets of tenants, on top of Riot's rate limits. Like the circuit breakers, quotas are accessed by every request directly,
+hence they are guarded by a mutex instead of the main loop
+*/
+type Quotas struct {
+	mu        sync.Mutex
+	buckets   map[string][]*window // by tenant and scope
+	limits    map[string][]limit   // by tenant
+	opts      *options.TenantOptions
+	lastSweep time.Time
+}
+
+// Creates the quotas of all tenants. Panics on malformed quotas, like all other invalid options
+func NewQuotas(opts *options.TenantOptions) *Quotas {
+	quotas := &Quotas{
+		buckets: make(map[string][]*window),
+		limits:  make(map[string][]limit),
+		opts:    opts,
+	}
+
+	for id, tenant := range opts.Tenants {
+		if tenant.Quota == "" {
+			continue
+		}
+
+		limits, err := parseQuota(tenant.Quota)
+		if err != nil {
+			panic("Invalid quota for tenant " + id + ": " + err.Error())
+		}
+		quotas.limits[id] = limits
+	}
+
+	return quotas
+}
+
+/*
+INTERNAL:
+Parses a quota in the format of Riot's rate limit headers, e.g. "10:1,300:60"
+*/
+func parseQuota(quota string) ([]limit, error) {
+	var limits []limit
+	for _, value := range strings.Split(quota, ",") {
+		split := strings.SplitN(strings.TrimSpace(value), ":", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid quota %q, expected <limit>:<window>", value)
+		}
+
+		count, err := strconv.Atoi(split[0])
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid limit in quota %q", value)
+		}
+
+		seconds, err := strconv.Atoi(split[1])
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid window in quota %q", value)
+		}
+
+		limits = append(limits, limit{limit: count, window: time.Duration(seconds) * time.Second})
+	}
+
+	return limits, nil
+}
+
+/*
+Spends a token of the tenant's quota for the request. Returns the tokens remaining in the strictest window, negative if the tenant has no quota.
+If the quota is exhausted, the time the window that blocks the request is over is returned
+*/
+func (q *Quotas) Take(tenant string, syntax *schema.Syntax, now time.Time) (bool, int, time.Time) {
+	tenant, limits := q.resolve(tenant)
+	if len(limits) == 0 {
+		return true, -1, time.Time{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sweep(now)
+	windows := q.bucket(tenant, syntax, limits)
+
+	retryAt := time.Time{}
+	for _, w := range windows {
+		// The window is over, it starts again with this request
+		if !now.Before(w.start.Add(w.window)) {
+			w.current = 0
+		}
+
+		if w.current >= w.limit.limit && w.start.Add(w.window).After(retryAt) {
+			retryAt = w.start.Add(w.window)
+		}
+	}
+
+	if !retryAt.IsZero() {
+		return false, 0, retryAt
+	}
+
+	remaining := -1
+	for _, w := range windows {
+		if w.current == 0 {
+			w.start = now
+		}
+		w.current++
+
+		if left := w.limit.limit - w.current; remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+
+	return true, remaining, time.Time{}
+}
+
+/*
+Gives back a token taken at takenAt, for requests which never reached Riot.
+Windows which started again since then are left alone, the token isn't part of them
+*/
+func (q *Quotas) Refund(tenant string, syntax *schema.Syntax, takenAt time.Time) {
+	tenant, limits := q.resolve(tenant)
+	if len(limits) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	windows, Ok := q.buckets[q.bucketKey(tenant, syntax)]
+	if !Ok {
+		return
+	}
+
+	for _, w := range windows {
+		if w.current > 0 && !takenAt.Before(w.start) && takenAt.Before(w.start.Add(w.window)) {
+			w.current--
+		}
+	}
+}
+
+/*
+INTERNAL:
+Returns the tenant whose quota applies and its limits. All unknown tenants share the quota of "*",
+so a client can't get a fresh budget by using another id
+*/
+func (q *Quotas) resolve(tenant string) (string, []limit) {
+	if _, Ok := q.opts.Tenants[tenant]; !Ok {
+		tenant = "*"
+	}
+
+	return tenant, q.limits[tenant]
+}
+
+func (q *Quotas) bucketKey(tenant string, syntax *schema.Syntax) string {
+	key := tenant
+	switch q.opts.Tenant(tenant).QuotaScope {
+	case ScopePlatform:
+		key += " " + syntax.Platform
+	case ScopeMethod:
+		key += " " + syntax.Id
+	}
+
+	return key
+}
+
+func (q *Quotas) bucket(tenant string, syntax *schema.Syntax, limits []limit) []*window {
+	key := q.bucketKey(tenant, syntax)
+	windows, Ok := q.buckets[key]
+	if !Ok {
+		windows = make([]*window, len(limits))
+		for i, l := range limits {
+			windows[i] = &window{limit: l}
+		}
+		q.buckets[key] = windows
+	}
+
+	return windows
+}
+
+// INTERNAL: Removes buckets whose windows are all over, they would start from scratch anyway
+func (q *Quotas) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < sweepInterval {
+		return
+	}
+	q.lastSweep = now
+
+	for key, windows := range q.buckets {
+		expired := true
+		for _, w := range windows {
+			if now.Before(w.start.Add(w.window)) {
+				expired = false
+			}
+		}
+
+		if expired {
+			delete(q.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package ratelimiter
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/queue"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+type adminAction int
+
+const (
+	adminPause adminAction = iota
+	adminResume
+	adminFlush
+	adminRediscover
+)
+
+// An operation of the admin API, executed by the main loop
+type adminOperation struct {
+	action     adminAction
+	target     queue.Target
+	until      time.Time  // end of a pause, forever if zero
+	status     int        // status of flushed requests
+	retryAfter *time.Time // Optional, of flushed requests
+	response   chan int   // amount of affected pauses, groups or requests
+}
+
+/*
+INTERNAL:
+Creates the admin API, which is served on its own port. Only the main loop may touch the queues,
+hence every read and operation is answered by the main loop.
+Operations are only available with an admin token
+*/
+func (rl *RateLimiter) newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", rl.authorizeAdmin(rl.serveState))
+
+	if rl.opts.AdminToken != "" {
+		mux.HandleFunc("POST /pause", rl.authorizeAdmin(rl.servePause))
+		mux.HandleFunc("POST /resume", rl.authorizeAdmin(rl.serveResume))
+		mux.HandleFunc("POST /flush", rl.authorizeAdmin(rl.serveFlush))
+		mux.HandleFunc("POST /rediscover", rl.authorizeAdmin(rl.serveRediscover))
+	} else {
+		log.Println("Admin operations are disabled, set an admin token to enable them")
+	}
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", rl.opts.AdminPort),
+		Handler: mux,
+	}
+}
+
+/*
+INTERNAL:
+Returns the rate limits of every key and the queues as JSON
+*/
+func (rl *RateLimiter) serveState(w http.ResponseWriter, r *http.Request) {
+	response := make(chan *queue.State, 1)
+	timeout := time.After(configs.ADMIN_REQUEST_TIMEOUT)
+
+	select {
+	case rl.stateChannel <- response:
+	case <-r.Context().Done():
+		return
+	case <-timeout:
+		http.Error(w, "Main loop is not responding", http.StatusServiceUnavailable)
+		return
+	}
+
+	var state *queue.State
+	select {
+	case state = <-response:
+	case <-r.Context().Done():
+		return
+	case <-timeout:
+		http.Error(w, "Main loop is not responding", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+/*
+INTERNAL:
+Requires the admin token as bearer token, if one is set
+*/
+func (rl *RateLimiter) authorizeAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rl.opts.AdminToken != "" {
+			token, Ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !Ok || subtle.ConstantTimeCompare([]byte(token), []byte(rl.opts.AdminToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cosmic-radiance-admin"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		handler(w, r)
+	}
+}
+
+/*
+INTERNAL:
+Pauses the dispatch of the targeted platforms, methods and keys. The optional duration is in seconds
+*/
+func (rl *RateLimiter) servePause(w http.ResponseWriter, r *http.Request) {
+	target, Ok := rl.adminTarget(w, r, false)
+	if !Ok {
+		return
+	}
+
+	var until time.Time
+	if duration := r.URL.Query().Get("duration"); duration != "" {
+		seconds, err := strconv.Atoi(duration)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		until = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+
+	rl.runAdminOperation(w, r, &adminOperation{action: adminPause, target: target, until: until}, "paused")
+}
+
+/*
+INTERNAL:
+Resumes a pause with the same target
+*/
+func (rl *RateLimiter) serveResume(w http.ResponseWriter, r *http.Request) {
+	target, Ok := rl.adminTarget(w, r, false)
+	if !Ok {
+		return
+	}
+
+	rl.runAdminOperation(w, r, &adminOperation{action: adminResume, target: target}, "resumed")
+}
+
+/*
+INTERNAL:
+Answers all requests in the targeted queues with the given status, 503 by default. The optional Retry-After is in seconds
+*/
+func (rl *RateLimiter) serveFlush(w http.ResponseWriter, r *http.Request) {
+	target, Ok := rl.adminTarget(w, r, true)
+	if !Ok {
+		return
+	}
+
+	operation := &adminOperation{action: adminFlush, target: target, status: http.StatusServiceUnavailable}
+	if status := r.URL.Query().Get("status"); status != "" {
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 400 || code > 599 {
+			http.Error(w, "Invalid status, it has to be an error status", http.StatusBadRequest)
+			return
+		}
+		operation.status = code
+	}
+
+	if retryAfter := r.URL.Query().Get("retryAfter"); retryAfter != "" {
+		seconds, err := strconv.Atoi(retryAfter)
+		if err != nil || seconds < 0 {
+			http.Error(w, "Invalid retryAfter", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(time.Duration(seconds) * time.Second)
+		operation.retryAfter = &t
+	}
+
+	rl.runAdminOperation(w, r, operation, "flushed")
+}
+
+/*
+INTERNAL:
+Discovers the limits of the targeted methods and keys again with their next request
+*/
+func (rl *RateLimiter) serveRediscover(w http.ResponseWriter, r *http.Request) {
+	target, Ok := rl.adminTarget(w, r, false)
+	if !Ok {
+		return
+	}
+
+	rl.runAdminOperation(w, r, &adminOperation{action: adminRediscover, target: target}, "rediscovered")
+}
+
+/*
+INTERNAL:
+Reads the target of an operation from the query. Keys and priority classes are referenced by name
+*/
+func (rl *RateLimiter) adminTarget(w http.ResponseWriter, r *http.Request, withPriority bool) (queue.Target, bool) {
+	query := r.URL.Query()
+	target := queue.Target{
+		Platform:   query.Get("platform"),
+		Endpoint:   strings.Trim(query.Get("endpoint"), "/"),
+		HttpMethod: strings.ToUpper(query.Get("method")),
+		Key:        query.Get("key"),
+		Priority:   query.Get("priority"),
+	}
+
+	if target.Key != "" && !slices.ContainsFunc(rl.opts.ApiKeys, func(key options.KeyKV) bool { return key.Name == target.Key }) {
+		http.Error(w, "Unknown key", http.StatusBadRequest)
+		return target, false
+	}
+
+	if target.Priority != "" && (!withPriority || !slices.ContainsFunc(rl.opts.PriorityClasses, func(class options.PriorityClass) bool { return class.Name == target.Priority })) {
+		http.Error(w, "Unknown priority class", http.StatusBadRequest)
+		return target, false
+	}
+
+	return target, true
+}
+
+/*
+INTERNAL:
+Runs an operation in the main loop and returns the amount it affected as JSON
+*/
+func (rl *RateLimiter) runAdminOperation(w http.ResponseWriter, r *http.Request, operation *adminOperation, result string) {
+	operation.response = make(chan int, 1)
+	timeout := time.After(configs.ADMIN_REQUEST_TIMEOUT)
+
+	select {
+	case rl.adminChannel <- operation:
+	case <-r.Context().Done():
+		return
+	case <-timeout:
+		http.Error(w, "Main loop is not responding", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The operation is executed anyway, even if the admin doesn't wait for the result
+	var affected int
+	select {
+	case affected = <-operation.response:
+	case <-r.Context().Done():
+		return
+	case <-timeout:
+		http.Error(w, "Main loop is not responding", http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Printf("Admin %s %d for %+v\n", result, affected, operation.target)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{result: affected}); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+/*
+INTERNAL:
+Executes an operation of the admin API. Has to be called from the main loop
+*/
+func (rl *RateLimiter) handleAdminOperation(operation *adminOperation) {
+	now := time.Now()
+
+	var affected int
+	switch operation.action {
+	case adminPause:
+		affected = rl.queueManager.Pause(operation.target, operation.until, now)
+	case adminResume:
+		affected = rl.queueManager.Resume(operation.target, now)
+	case adminFlush:
+		affected = rl.queueManager.Flush(operation.target, operation.status, operation.retryAfter)
+	case adminRediscover:
+		affected = rl.queueManager.Rediscover(operation.target, now)
+	}
+
+	operation.response <- affected
+}
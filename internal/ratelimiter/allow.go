@@ -1,18 +1,18 @@
 package ratelimiter
 
 import (
-	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/queue"
-	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
 )
 
 func (rl *RateLimiter) processQueues(queues map[string]*queue.RingBuffer) {
-	batchSize := configs.MAX_BATCH_SIZE_NORMAL
-
 	for _, queue := range queues {
-		if queue.Priority == request.HighPriority {
-			batchSize = configs.MAX_BATCH_SIZE_PRIORITY
+		refunded := queue.Process(queue.Class.BatchSize)
+
+		if rl.opts.PrometheusEnabled {
+			for _, keyId := range refunded {
+				metrics.UpdateRefunds(rl.opts.ApiKeys[keyId].Name, queue.Syntax.Platform, queue.Syntax.HttpMethod, queue.Syntax.Endpoint, string(RefundAbandoned))
+			}
 		}
-		queue.Process(batchSize)
 	}
 }
@@ -0,0 +1,86 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/auth"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+)
+
+// Context key of the authenticated client of a request
+type clientKey struct{}
+
+/*
+INTERNAL:
+Authenticates the client of a request, if authentication is enabled. Unauthenticated requests are rejected with 401.
+Returns the request with the client id in its context and whether it may continue
+*/
+func (rl *RateLimiter) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if rl.auth == nil {
+		return r, true
+	}
+
+	now := time.Now()
+	client, err := rl.auth.Authenticate(r, now)
+	if err != nil {
+		rl.logRejection(r, err, now)
+		if rl.opts.PrometheusEnabled {
+			reason := "invalid"
+			if errors.Is(err, auth.ErrMissingCredentials) {
+				reason = "missing"
+			}
+			metrics.UpdateAuthFailures(reason)
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cosmic-radiance"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return r, false
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), clientKey{}, client)), true
+}
+
+// INTERNAL: Logs a rejected request, unless another one was logged within the log interval. Those are counted instead
+func (rl *RateLimiter) logRejection(r *http.Request, err error, now time.Time) {
+	rl.authLogMu.Lock()
+	defer rl.authLogMu.Unlock()
+
+	rl.authRejections++
+	if now.Sub(rl.lastAuthLog) < configs.AUTH_LOG_INTERVAL {
+		return
+	}
+
+	if rl.authRejections > 1 {
+		log.Printf("Rejected request from %s: %v (%d rejected requests since the last log)\n", r.RemoteAddr, err, rl.authRejections)
+	} else {
+		log.Printf("Rejected request from %s: %v\n", r.RemoteAddr, err)
+	}
+
+	rl.lastAuthLog = now
+	rl.authRejections = 0
+}
+
+// INTERNAL: Returns the authenticated client of a request, empty without authentication
+func requestClient(r *http.Request) string {
+	client, _ := r.Context().Value(clientKey{}).(string)
+	return client
+}
+
+// INTERNAL: Reloads the client credentials if the file changed
+func (rl *RateLimiter) reloadClients() {
+	if rl.auth == nil {
+		return
+	}
+
+	clients, err := rl.auth.Reload()
+	if err != nil {
+		log.Printf("Failed to reload clients from %s, keeping the current ones: %v\n", rl.opts.AuthFile, err)
+	} else if clients >= 0 {
+		log.Printf("Reloaded %d clients from %s\n", clients, rl.opts.AuthFile)
+	}
+}
@@ -0,0 +1,132 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/cache"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// Headers that are stored alongside the body. Rate limit headers are left out, they are outdated on a hit
+var cachedHeaders = []string{"Content-Type", "Content-Encoding", "Content-Length"}
+
+// Identifies identical requests by their route id (platform, endpoint and HTTP method), the actual path and the sorted query
+func requestKey(syntax *schema.Syntax, query url.Values) string {
+	return syntax.Id + " " + syntax.Method + "?" + query.Encode()
+}
+
+/*
+INTERNAL:
+Returns the cache TTL of a request. Only GET requests of endpoints with a TTL are cached
+*/
+func (rl *RateLimiter) cacheTTL(syntax *schema.Syntax) (time.Duration, bool) {
+	if rl.cache == nil || syntax.HttpMethod != http.MethodGet {
+		return 0, false
+	}
+
+	ttl, Ok := rl.opts.Cache.TTLs[syntax.Endpoint]
+	if !Ok {
+		ttl, Ok = rl.opts.Cache.TTLs["*"]
+	}
+
+	if !Ok || ttl == 0 {
+		return 0, false
+	}
+
+	return ttl, true
+}
+
+/*
+INTERNAL:
+Serves a response from the cache, if it exists. Records hits and misses
+*/
+func (rl *RateLimiter) serveCached(w http.ResponseWriter, syntax *schema.Syntax, key string) bool {
+	entry, Ok := rl.cache.Get(key, time.Now())
+
+	if rl.opts.PrometheusEnabled {
+		metrics.UpdateCacheRequests(syntax.Platform, syntax.HttpMethod, syntax.Endpoint, Ok)
+	}
+
+	if !Ok {
+		return false
+	}
+
+	writeHit(w, entry.StatusCode, entry.Header, entry.Body)
+	return true
+}
+
+// Writes a response served from the cache or the response store
+func writeHit(w http.ResponseWriter, statusCode int, header http.Header, body []byte) {
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", "HIT")
+
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+/*
+INTERNAL:
+Stores successful and not found responses. 404s expire after the not found TTL, if the endpoint's TTL isn't shorter
+*/
+func (rl *RateLimiter) cacheResponse(key string, ttl time.Duration, response *http.Response, body []byte) {
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		notFoundTTL := rl.opts.Cache.NotFoundTTL
+		if notFoundTTL == 0 {
+			return
+		}
+
+		if ttl < 0 || notFoundTTL < ttl {
+			ttl = notFoundTTL
+		}
+	default:
+		return
+	}
+
+	header := cachedHeader(response, body)
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	rl.cache.Set(key, response.StatusCode, header, body, expires)
+
+	if rl.opts.PrometheusEnabled {
+		metrics.UpdateCacheSize(rl.cache.Size())
+	}
+}
+
+// Headers of a response that are kept alongside its body
+func cachedHeader(response *http.Response, body []byte) http.Header {
+	header := make(http.Header)
+	for _, name := range cachedHeaders {
+		if values := response.Header[name]; len(values) > 0 {
+			header[name] = values
+		}
+	}
+	// The body is fully read, so its length is known even for chunked responses
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+
+	return header
+}
+
+// Creates the response cache, if enabled
+func newResponseCache(maxBytes int64) *cache.Cache {
+	if maxBytes == 0 {
+		return nil
+	}
+
+	return cache.NewCache(maxBytes, maxBytes/configs.CACHE_MAX_ENTRY_FRACTION)
+}
@@ -0,0 +1,25 @@
+package ratelimiter
+
+import (
+	"log"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/breaker"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+)
+
+/*
+INTERNAL:
+Logs and reports state changes of circuit breakers. Endpoint and HTTP method are empty for per platform breakers
+*/
+func (rl *RateLimiter) onBreakerStateChange(platform string, endpoint string, httpMethod string, from breaker.State, to breaker.State) {
+	target := platform
+	if endpoint != "" {
+		target = httpMethod + " " + platform + "/" + endpoint
+	}
+
+	log.Printf("Circuit breaker for %s changed from %s to %s\n", target, from, to)
+
+	if rl.opts.PrometheusEnabled {
+		metrics.UpdateBreakerState(platform, httpMethod, endpoint, int(to))
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// Headers waiters share with the leader. Others like X-Key or X-Attempts belong to the leader's request
+var coalescedHeaders = append(slices.Clip(cachedHeaders), "Retry-After")
+
+// An upstream call shared by identical requests. The response is set before done is closed
+type coalescedCall struct {
+	done     chan struct{}
+	tenant   string         // tenant of the leader
+	outcome  forwardOutcome // if the leader was abandoned or rejected by its quota, another waiter has to take over
+	response *recordingWriter
+}
+
+// Writes through to the leader's client while recording the response for the other waiters
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(statusCode int) {
+	if rw.statusCode != 0 {
+		return
+	}
+
+	rw.statusCode = statusCode
+	rw.header = rw.ResponseWriter.Header().Clone()
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+/*
+INTERNAL:
+Serves identical in-flight requests with a single upstream call. The first request becomes the leader and is forwarded,
+the others wait for its response until their own deadline passes or their client leaves.
+If the leader is abandoned, one of the waiters is forwarded instead. The same applies to waiters of other tenants,
+if the leader is rejected by its tenant's quota.
+*/
+func (rl *RateLimiter) serveCoalesced(w http.ResponseWriter, r *http.Request, syntax *schema.Syntax, key string, deadline time.Time, forward func(w http.ResponseWriter, deadline time.Time) forwardOutcome) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	tenant := rl.requestTenant(r)
+
+	for {
+		rl.coalesceMu.Lock()
+		call, Ok := rl.inFlight[key]
+		if !Ok {
+			call = &coalescedCall{done: make(chan struct{}), tenant: tenant}
+			rl.inFlight[key] = call
+			rl.coalesceMu.Unlock()
+
+			rl.leadCoalesced(w, key, deadline, call, forward)
+			return
+		}
+		rl.coalesceMu.Unlock()
+
+		select {
+		case <-r.Context().Done():
+			if rl.opts.PrometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 499)
+			}
+			return
+
+		case <-timer.C:
+			http.Error(w, "Request dropped due to timeout", http.StatusTooManyRequests)
+			if rl.opts.PrometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 408)
+			}
+			return
+
+		case <-call.done:
+			if call.outcome == forwardAbandoned || (call.outcome == forwardRejected && call.tenant != tenant) {
+				continue
+			}
+		}
+
+		response := call.response
+		for _, name := range coalescedHeaders {
+			if values := response.header[name]; len(values) > 0 {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("X-Coalesced", "true")
+
+		if rl.opts.PrometheusEnabled {
+			metrics.UpdateCoalescedRequests(syntax.Platform, syntax.HttpMethod, syntax.Endpoint)
+		}
+
+		w.WriteHeader(response.statusCode)
+		if _, err := w.Write(response.body.Bytes()); err != nil {
+			log.Printf("Error writing response: %v", err)
+		}
+		return
+	}
+}
+
+/*
+INTERNAL:
+Forwards the request of the leader and hands its response to the waiters
+*/
+func (rl *RateLimiter) leadCoalesced(w http.ResponseWriter, key string, deadline time.Time, call *coalescedCall, forward func(w http.ResponseWriter, deadline time.Time) forwardOutcome) {
+	recorder := &recordingWriter{ResponseWriter: w}
+	call.outcome = forwardAbandoned
+
+	// Waiters must never be left hanging, even if forwarding panics
+	defer func() {
+		rl.coalesceMu.Lock()
+		delete(rl.inFlight, key)
+		rl.coalesceMu.Unlock()
+
+		close(call.done)
+	}()
+
+	outcome := forward(recorder, deadline)
+	if recorder.statusCode == 0 {
+		outcome = forwardAbandoned
+	}
+
+	call.response = recorder
+	call.outcome = outcome
+}
@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// State for the liveness and readiness probes. It is read outside of the main loop, hence atomic
+type health struct {
+	lastTick     atomic.Int64   // unix nanoseconds of the last polling tick of the main loop
+	listening    atomic.Bool    // the proxy accepts connections
+	draining     atomic.Bool    // shutting down, no new requests should be sent
+	lockedKeys   []atomic.Bool  // by key id, locked or paused on every platform. Updated by the main loop
+	invalidUntil []atomic.Int64 // by key id, unix nanoseconds until a key rejected by Riot is considered invalid
+}
+
+func newHealth(keys int) *health {
+	return &health{
+		lockedKeys:   make([]atomic.Bool, keys),
+		invalidUntil: make([]atomic.Int64, keys),
+	}
+}
+
+/*
+INTERNAL:
+Returns 200 as long as the main loop is alive, which processes the queues on every polling tick
+*/
+func (rl *RateLimiter) serveHealth(w http.ResponseWriter) {
+	age := time.Since(time.Unix(0, rl.health.lastTick.Load()))
+	if age > configs.HEALTH_MAX_TICK_AGE+rl.opts.PollingInterval {
+		http.Error(w, fmt.Sprintf("Main loop is not responding, last tick %s ago", age.Round(time.Millisecond)), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+/*
+INTERNAL:
+Returns 200 if the proxy can serve requests. It isn't ready while shutting down, so load balancers stop sending requests
+*/
+func (rl *RateLimiter) serveReady(w http.ResponseWriter) {
+	reason := ""
+	switch {
+	case rl.health.draining.Load():
+		reason = "Shutting down"
+	case !rl.health.listening.Load():
+		reason = "Proxy is not listening"
+	case schema.RouteCount() == 0:
+		reason = "No route table loaded"
+	case !rl.keyAvailable(time.Now()):
+		reason = "All keys are locked or invalid"
+	}
+
+	if reason != "" {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+/*
+INTERNAL:
+Reports whether at least one key is neither locked nor rejected by Riot
+*/
+func (rl *RateLimiter) keyAvailable(now time.Time) bool {
+	for keyId := range rl.health.lockedKeys {
+		if !rl.health.lockedKeys[keyId].Load() && rl.health.invalidUntil[keyId].Load() < now.UnixNano() {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+INTERNAL:
+Updates the locked keys. Has to be called from the main loop
+*/
+func (rl *RateLimiter) updateLockedKeys(now time.Time) {
+	for keyId, locked := range rl.queueManager.LockedKeys(now) {
+		rl.health.lockedKeys[keyId].Store(locked)
+	}
+}
+
+/*
+INTERNAL:
+Tracks whether Riot accepts a key. Rejected keys are considered invalid for a while, until they succeed again.
+Riot also answers 403 for endpoints a key may not use, so only 401 marks a key invalid
+*/
+func (rl *RateLimiter) reportKeyStatus(keyId int, status int) {
+	invalidUntil := &rl.health.invalidUntil[keyId]
+
+	switch {
+	case status == http.StatusUnauthorized:
+		if invalidUntil.Swap(time.Now().Add(configs.INVALID_KEY_DURATION).UnixNano()) < time.Now().UnixNano() {
+			log.Printf("%s was rejected with %d, considering it invalid\n", rl.opts.ApiKeys[keyId].Name, status)
+		}
+	case status >= 200 && status < 300:
+		invalidUntil.Store(0)
+	}
+}
@@ -0,0 +1,35 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
+)
+
+/*
+INTERNAL:
+Returns the priority class of a request. Clients select a class with the X-Priority header,
+either by its name or by its index (0 being the highest). Unknown values fall back to the default class
+*/
+func (rl *RateLimiter) requestPriority(r *http.Request) request.Priority {
+	header := strings.TrimSpace(r.Header.Get("X-Priority"))
+	classes := rl.opts.PriorityClasses
+
+	if index, err := strconv.Atoi(header); err == nil && index >= 0 && index < len(classes) {
+		return request.Priority(index)
+	}
+
+	defaultPriority := len(classes) - 1
+	for index, class := range classes {
+		if header != "" && strings.EqualFold(class.Name, header) {
+			return request.Priority(index)
+		}
+		if class.Name == rl.opts.DefaultPriority {
+			defaultPriority = index
+		}
+	}
+
+	return request.Priority(defaultPriority)
+}
@@ -4,31 +4,62 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/auth"
 	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 
+	"github.com/DarkIntaqt/cosmic-radiance/internal/breaker"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/cache"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/queue"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/quota"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
 )
 
 type RateLimiter struct {
 	queueManager *queue.QueueManager
+	router       *schema.Router
+	breakers     *breaker.Breakers
+	quotas       *quota.Quotas       // token budgets of tenants, checked before requests are queued
+	cache        *cache.Cache        // nil if disabled
+	storeWrites  chan struct{}       // limits the writes to the response store running in the background
+	auth         *auth.Authenticator // nil if disabled
+	health       *health
 
 	incomingChannel chan IncomingRequest
 	updateChannel   chan Update
 	stopSignal      chan os.Signal
 	close           chan struct{}
-	// refundChannel   chan Refund
+	done            chan struct{} // closed once the main loop stopped, senders must not wait for it then
+	refundChannel   chan Refund
+	stateChannel    chan chan *queue.State // reads of the admin API
+	adminChannel    chan *adminOperation   // operations of the admin API
 
 	started bool
 	client  *http.Client
 
+	// Identical GET requests currently waiting for an upstream call, by request key
+	coalesceMu sync.Mutex
+	inFlight   map[string]*coalescedCall
+
+	// Unauthenticated clients could flood the log, so rejections are only logged once per interval
+	authLogMu      sync.Mutex
+	lastAuthLog    time.Time
+	authRejections int // since the last log
+
+	// Serializes snapshot writes, as periodic writes happen outside the main loop
+	snapshotMu   sync.Mutex
+	lastSnapshot time.Time
+
 	opts *options.RateLimiterOptions
 }
 
@@ -39,17 +70,47 @@ func NewRateLimiter(opts *options.RateLimiterOptions) *RateLimiter {
 
 	options.ValidateRateLimiterOptions(opts)
 
+	// Without configured classes, high priority requests get a share of the queue, skip the smoothing and may use the reserve
+	if len(opts.PriorityClasses) == 0 {
+		opts.PriorityClasses = []options.PriorityClass{
+			{Name: "high", QueueShare: opts.PriorityQueueSize, BatchSize: configs.MAX_BATCH_SIZE_PRIORITY, Burst: true},
+			{Name: "normal", QueueShare: 1, BatchSize: configs.MAX_BATCH_SIZE_NORMAL, Reserve: opts.PriorityReserve},
+		}
+	}
+	opts.PriorityClasses = slices.Clone(opts.PriorityClasses)
+
+	if opts.DefaultPriority == "" {
+		opts.DefaultPriority = opts.PriorityClasses[len(opts.PriorityClasses)-1].Name
+	}
+
+	// Without an upper bound, clients can only shorten their timeout
+	if opts.MaxTimeout == 0 {
+		opts.MaxTimeout = max(opts.Timeout, opts.MinTimeout)
+	}
+
 	if configs.MAX_UTILIZATION_FACTOR <= 0 || configs.MAX_UTILIZATION_FACTOR > 1 {
 		panic("Invalid MAX_UTILIZATION_FACTOR")
 	}
 
+	// Override the embedded route table if another source is configured
+	if opts.SchemaSource != "" {
+		if err := schema.Load(opts.SchemaSource); err != nil {
+			log.Printf("Failed to load route table from %s, using the embedded one instead: %v\n", opts.SchemaSource, err)
+		}
+	}
+
 	queueManager := queue.NewQueueManager(opts)
 
 	stopSignal := make(chan os.Signal, 1)
 	signal.Notify(stopSignal, syscall.SIGINT, syscall.SIGTERM)
 
-	return &RateLimiter{
+	rl := &RateLimiter{
 		queueManager: queueManager,
+		router:       schema.DefaultRouter(),
+		cache:        newResponseCache(opts.Cache.MaxBytes),
+		inFlight:     make(map[string]*coalescedCall),
+		storeWrites:  make(chan struct{}, configs.MAX_PENDING_STORE_WRITES),
+		health:       newHealth(len(opts.ApiKeys)),
 		stopSignal:   stopSignal,
 		started:      false,
 		close:        make(chan struct{}),
@@ -58,6 +119,25 @@ func NewRateLimiter(opts *options.RateLimiterOptions) *RateLimiter {
 			Timeout: 5 * time.Second,
 		},
 	}
+
+	rl.breakers = breaker.NewBreakers(&opts.CircuitBreaker, rl.onBreakerStateChange)
+	rl.quotas = quota.NewQuotas(&opts.Tenants)
+
+	// Clients have to authenticate, if credentials are configured
+	if opts.AuthFile != "" {
+		authenticator, err := auth.NewAuthenticator(opts.AuthFile)
+		if err != nil {
+			panic("Failed to load clients from " + opts.AuthFile + ": " + err.Error())
+		}
+		rl.auth = authenticator
+	}
+
+	// Restore the rate limits of the last run, so they don't have to be discovered again
+	if opts.SnapshotPath != "" {
+		rl.loadSnapshot()
+	}
+
+	return rl
 }
 
 /*
@@ -73,11 +153,15 @@ func (rl *RateLimiter) Start() {
 	rl.started = true
 
 	log.Printf("Running Cosmic-Radiance v%s on :%d\n", configs.VERSION, rl.opts.Port)
+	log.Printf("Using route table version %s from %s with %d routes\n", schema.Version(), schema.Source(), schema.RouteCount())
 
 	// Create all channels,
 	rl.incomingChannel = make(chan IncomingRequest)
 	rl.updateChannel = make(chan Update)
-	// rl.refundChannel = make(chan Refund)
+	rl.refundChannel = make(chan Refund, configs.REFUND_BUFFER_SIZE)
+	rl.stateChannel = make(chan chan *queue.State)
+	rl.adminChannel = make(chan *adminOperation)
+	rl.done = make(chan struct{})
 
 	// Add a cancel function
 	ctx, cancelCtx := context.WithCancel(context.Background())
@@ -92,21 +176,44 @@ func (rl *RateLimiter) Start() {
 		rl.mainLoop(ctx)
 	}()
 
+	// Keep the route table up to date in the background
+	go rl.refreshLoop(ctx)
+
 	// Create the http proxy
 	proxy := &http.Server{
 		Addr:    fmt.Sprintf(":%d", rl.opts.Port),
 		Handler: rl,
 	}
 
+	// Listen before serving, so the readiness probe knows the proxy is up
+	listener, err := net.Listen("tcp", proxy.Addr)
+	if err != nil {
+		log.Fatalf("Proxy crashed: %v\n", err)
+	}
+	rl.health.listening.Store(true)
+
 	// Serve the http proxy
 	go func() {
 		log.Println("Starting proxy")
 
-		if err := proxy.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := proxy.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Proxy crashed: %v\n", err)
 		}
 	}()
 
+	// Serve the admin API on its own port, so it doesn't have to be exposed with the proxy
+	var admin *http.Server
+	if rl.opts.AdminPort > 0 {
+		admin = rl.newAdminServer()
+		go func() {
+			log.Printf("Starting admin API on :%d\n", rl.opts.AdminPort)
+
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin API crashed: %v\n", err)
+			}
+		}()
+	}
+
 	// Listen to TERM signals, if so, shut down
 	<-rl.stopSignal
 
@@ -114,6 +221,13 @@ func (rl *RateLimiter) Start() {
 	println("")
 	log.Println("Shutting down...")
 
+	// Fail the readiness probe first, then give load balancers time to stop sending requests
+	rl.health.draining.Store(true)
+	if rl.opts.ShutdownDelay > 0 {
+		log.Printf("Waiting %s for load balancers to stop sending requests\n", rl.opts.ShutdownDelay)
+		time.Sleep(rl.opts.ShutdownDelay)
+	}
+
 	// Cancel the context to stop the goroutine
 	cancelCtx()
 
@@ -127,10 +241,13 @@ func (rl *RateLimiter) Start() {
 	} else {
 		log.Println("Bye bye from the proxy")
 	}
+	rl.health.listening.Store(false)
 
-	close(rl.incomingChannel)
-	close(rl.updateChannel)
-	// close(rl.refundChannel)
+	if admin != nil {
+		if err := admin.Shutdown(stop); err != nil {
+			log.Printf("Admin API forced to shutdown: %v\n", err)
+		}
+	}
 
 	// Waiting for the goroutine to finish or the context to be done
 	// TODO: I don't know if there *could* be a race condition here causing the proxy to stop with ctx.stop and the goroutine not finishing.
@@ -143,6 +260,11 @@ func (rl *RateLimiter) Start() {
 	log.Println("Successfully shut down")
 }
 
+// Returns the router used to match incoming requests. It always uses the latest route table
+func (rl *RateLimiter) Router() *schema.Router {
+	return rl.router
+}
+
 func (rl *RateLimiter) Stop() {
 	if rl.started {
 		rl.stopSignal <- syscall.SIGTERM
@@ -164,6 +286,16 @@ func (rl *RateLimiter) mainLoop(ctx context.Context) {
 		metricsTicker.Stop()
 	}
 
+	snapshotTicker := time.NewTicker(configs.DEFAULT_SNAPSHOT_INTERVAL)
+	if rl.opts.SnapshotPath != "" && rl.opts.SnapshotInterval > 0 {
+		snapshotTicker.Reset(rl.opts.SnapshotInterval)
+	} else {
+		snapshotTicker.Stop()
+	}
+
+	healthTicker := time.NewTicker(configs.HEALTH_UPDATE_INTERVAL)
+	rl.health.lastTick.Store(time.Now().UnixNano())
+
 	pollingTicker := time.NewTicker(rl.opts.PollingInterval)
 	for {
 		select {
@@ -176,8 +308,14 @@ func (rl *RateLimiter) mainLoop(ctx context.Context) {
 				rl.queueManager.AdjustQueueSize()
 			}
 
-		// case refund := <-rl.refundChannel:
-		// 	rl.handleRefund(refund)
+		case refund := <-rl.refundChannel:
+			rl.handleRefund(refund)
+
+		case response := <-rl.stateChannel:
+			response <- rl.queueManager.State(time.Now())
+
+		case operation := <-rl.adminChannel:
+			rl.handleAdminOperation(operation)
 
 		case <-ctx.Done():
 			cleanUpTicker.Stop()
@@ -185,26 +323,46 @@ func (rl *RateLimiter) mainLoop(ctx context.Context) {
 				metricsTicker.Stop()
 			}
 			pollingTicker.Stop()
+			snapshotTicker.Stop()
+			healthTicker.Stop()
 
 			// Drain all queues before shutting down
 			rl.queueManager.Drain()
 
+			// Persist the rate limits for the next start
+			if rl.opts.SnapshotPath != "" {
+				rl.writeSnapshot(rl.queueManager.Snapshot())
+			}
+
 			// This is intended and absolutely necessary
 			log.Println("Bye bye from the main loop")
 
+			// The channels stay open, handlers still running after the shutdown deadline select on done instead
+			close(rl.done)
+
 			// Send data to notify the main thread that worker has finished
 			rl.close <- struct{}{}
 			return
 		case <-metricsTicker.C:
-			metrics.UpdateQueueSizes(rl.queueManager)
+			metrics.UpdateQueueSizes(rl.queueManager, rl.opts)
+
+		case <-snapshotTicker.C:
+			// The snapshot is taken in the main loop, writing it to disk is not
+			go rl.writeSnapshot(rl.queueManager.Snapshot())
 
 		case <-cleanUpTicker.C:
 			rl.queueManager.CleanUp()
 
-		case <-pollingTicker.C:
+		case now := <-healthTicker.C:
+			rl.updateLockedKeys(now)
+
+		case now := <-pollingTicker.C:
+			rl.health.lastTick.Store(now.UnixNano())
 			rl.refillRateLimits()
-			rl.processQueues(rl.queueManager.PriorityQueues)
-			rl.processQueues(rl.queueManager.Queues)
+			// Higher priority classes are dispatched first
+			for _, queues := range rl.queueManager.Queues {
+				rl.processQueues(queues)
+			}
 		}
 
 	}
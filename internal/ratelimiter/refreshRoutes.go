@@ -0,0 +1,79 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+var errNoSchemaSource = errors.New("no schema source configured")
+
+/*
+INTERNAL:
+Refreshes the route table in the configured interval or whenever a SIGHUP is received.
+Client credentials are reloaded on SIGHUP as well, and whenever their file changes
+*/
+func (rl *RateLimiter) refreshLoop(ctx context.Context) {
+	hangupSignal := make(chan os.Signal, 1)
+	signal.Notify(hangupSignal, syscall.SIGHUP)
+	defer signal.Stop(hangupSignal)
+
+	// A nil channel blocks forever, which disables the periodic refresh
+	var refreshTicker <-chan time.Time
+	if rl.opts.SchemaRefreshInterval > 0 {
+		ticker := time.NewTicker(rl.opts.SchemaRefreshInterval)
+		defer ticker.Stop()
+		refreshTicker = ticker.C
+	}
+
+	var clientsTicker <-chan time.Time
+	if rl.auth != nil {
+		ticker := time.NewTicker(configs.AUTH_RELOAD_INTERVAL)
+		defer ticker.Stop()
+		clientsTicker = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-clientsTicker:
+			rl.reloadClients()
+
+		case <-refreshTicker:
+			rl.RefreshRoutes()
+
+		case <-hangupSignal:
+			log.Println("Received SIGHUP, refreshing route table and clients")
+			rl.RefreshRoutes()
+			rl.reloadClients()
+		}
+	}
+}
+
+/*
+Re-fetches the route table from the configured source and swaps it without interrupting in-flight requests.
+The embedded route table is never refreshed, so nothing is fetched without a configured source.
+*/
+func (rl *RateLimiter) RefreshRoutes() error {
+	source := rl.opts.SchemaSource
+	if source == "" {
+		log.Println("Skipping route table refresh, no schema source is configured")
+		return errNoSchemaSource
+	}
+
+	err := schema.Refresh(source)
+	if err != nil {
+		log.Printf("Failed to refresh route table from %s: %v\n", source, err)
+	}
+
+	return err
+}
@@ -1,25 +1,54 @@
 package ratelimiter
 
 import (
+	"log"
 	"time"
 
-	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
 	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
 )
 
+type RefundReason string
+
+const (
+	RefundNotSent   RefundReason = "not_sent"  // the request failed before it was sent to Riot
+	RefundAbandoned RefundReason = "abandoned" // the client left after the request was dequeued
+)
+
 type Refund struct {
-	Syntax      *schema.Syntax
-	Priority    request.Priority
-	RequestTime time.Time
-	KeyId       int
+	Syntax    *schema.Syntax
+	KeyId     int
+	AllowedAt time.Time
+	Reason    RefundReason
 }
 
-// func (rl *RateLimiter) handleRefund(refund Refund) {
-// 	if refund.Syntax == nil {
-// 		return
-// 	}
-// 	queue := rl.queueManager.GetQueue(*refund.Syntax, refund.Priority)
-// 	if queue != nil {
-// 		queue.Refund(refund.KeyId, refund.RequestTime)
-// 	}
-// }
+/*
+INTERNAL:
+Returns the token of a request to its rate limits. Only the main loop may touch the rate limits
+*/
+func (rl *RateLimiter) handleRefund(refund Refund) {
+	if refund.Syntax == nil {
+		return
+	}
+
+	if rl.queueManager.Refund(refund.Syntax.Id, refund.KeyId, refund.AllowedAt) && rl.opts.PrometheusEnabled {
+		metrics.UpdateRefunds(rl.opts.ApiKeys[refund.KeyId].Name, refund.Syntax.Platform, refund.Syntax.HttpMethod, refund.Syntax.Endpoint, string(refund.Reason))
+	}
+}
+
+/*
+INTERNAL:
+Hands a refund over to the main loop. Refunds are dropped instead of blocking the client if the main loop is busy
+*/
+func (rl *RateLimiter) refundRequest(syntax *schema.Syntax, keyId int, allowedAt time.Time, reason RefundReason) {
+	select {
+	case rl.refundChannel <- Refund{
+		Syntax:    syntax,
+		KeyId:     keyId,
+		AllowedAt: allowedAt,
+		Reason:    reason,
+	}:
+	default:
+		log.Printf("Refund channel is full, dropping refund for %s/%s\n", syntax.Platform, syntax.Endpoint)
+	}
+}
@@ -2,10 +2,13 @@ package ratelimiter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/DarkIntaqt/cosmic-radiance/configs"
@@ -28,109 +31,280 @@ func (rl *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Serve the probes, they don't need to authenticate
+	switch path {
+	case "/healthz":
+		rl.serveHealth(w)
+		return
+	case "/readyz":
+		rl.serveReady(w)
+		return
+	}
+
+	// Only authenticated clients may spend the rate limits
+	r, authenticated := rl.authenticate(w, r)
+	if !authenticated {
+		return
+	}
+
 	var syntax *schema.Syntax
+	var err error
 
 	// Determine the endpoints by using the proxy mode
 	if rl.opts.RequestMode == options.ProxyMode {
-		proxySyntax, err := schema.NewProxySyntax(r.URL.Host, path)
-		if err != nil {
-			w.Header().Set("Retry-After", "60")
-			http.Error(w, "Invalid path", http.StatusBadRequest)
+		syntax, err = rl.router.MatchProxy(r.URL.Host, r.Method, path)
+	} else {
+		syntax, err = rl.router.MatchPath(r.Method, path)
+	}
+
+	if err != nil {
+		// Tell the client which parameter is malformed, instead of just rejecting the path
+		message := "Invalid path"
+		var parameterErr *schema.InvalidParameterError
+		if errors.As(err, &parameterErr) {
+			message = parameterErr.Error()
+		}
+
+		var methodErr *schema.MethodNotAllowedError
+		if errors.As(err, &methodErr) {
+			w.Header().Set("Allow", strings.Join(methodErr.Allowed, ", "))
+			http.Error(w, methodErr.Error(), http.StatusMethodNotAllowed)
 			return
 		}
 
-		syntax = proxySyntax
-	} else {
-		pathSyntax, err := schema.NewPathSyntax(path)
-		if err != nil {
-			w.Header().Set("Retry-After", "60")
-			http.Error(w, "Invalid path", http.StatusBadRequest)
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	key := requestKey(syntax, r.URL.Query())
+
+	// Identical lookups are answered without spending any rate limit
+	if _, cacheable := rl.cacheTTL(syntax); cacheable && rl.serveCached(w, syntax, key) {
+		return
+	}
+
+	if rl.storable(syntax) && rl.serveStored(w, syntax, key) {
+		return
+	}
+
+	// Read the body upfront, so a broken body doesn't consume any rate limit
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, configs.MAX_REQUEST_BODY_SIZE))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 			return
 		}
-		syntax = pathSyntax
+
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	priority := request.NormalPriority
-	if r.Header.Get("X-Priority") == "high" {
-		priority = request.HighPriority
+	priority := rl.requestPriority(r)
+
+	deadline, err := rl.requestDeadline(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Identical GET requests share one queue slot and one upstream call
+	if rl.opts.CoalesceRequests && syntax.HttpMethod == http.MethodGet {
+		rl.serveCoalesced(w, r, syntax, key, deadline, func(w http.ResponseWriter, deadline time.Time) forwardOutcome {
+			return rl.forwardRequest(w, r, syntax, key, body, priority, deadline)
+		})
+		return
 	}
 
-	timeout := rl.opts.Timeout
+	rl.forwardRequest(w, r, syntax, key, body, priority, deadline)
+}
+
+// Outcome of a forwarded request, it decides whether coalesced waiters may share the response
+type forwardOutcome int
+
+const (
+	forwardServed    forwardOutcome = iota // the response applies to every identical request
+	forwardAbandoned                       // not served because of its own deadline or client, e.g. it timed out or was dropped from the queue
+	forwardRejected                        // answered, but rejected by the tenant's quota, which doesn't apply to other tenants
+)
+
+/*
+INTERNAL:
+Queues the request and forwards it to the Riot Games API once a key is available
+*/
+func (rl *RateLimiter) forwardRequest(w http.ResponseWriter, r *http.Request, syntax *schema.Syntax, key string, body []byte, priority request.Priority, deadline time.Time) forwardOutcome {
+	prometheusEnabled := rl.opts.PrometheusEnabled
+	cacheTTL, cacheable := rl.cacheTTL(syntax)
+	storable := rl.storable(syntax)
+
 	// Create a new request
-	req := request.NewRequest(timeout)
+	req := request.NewRequest(time.Until(deadline))
+	req.Tenant = rl.requestTenant(r)
+
+	// Tenants can't spend more than their own budget of the rate limits. Coalesced waiters aren't charged, only the leader is.
+	// A waiter of another tenant takes over, if the leader's quota is exhausted
+	quotaTakenAt, allowed := rl.takeQuota(w, syntax, req.Tenant)
+	if !allowed {
+		return forwardRejected
+	}
+
+	// Requests which never reach Riot, e.g. they time out or are rejected, get their quota back
+	dispatched := false
+	defer func() {
+		if !dispatched && !quotaTakenAt.IsZero() {
+			rl.quotas.Refund(req.Tenant, syntax, quotaTakenAt)
+		}
+	}()
 
 	// Don't leave dangling channels open
 	// defer close(req.Response)
 
-	// Enqueue request
-	rl.incomingChannel <- IncomingRequest{
-		Request:  req,
-		Syntax:   syntax,
-		Priority: priority,
-	}
-
 	// add one second on top to not drop requests which should've been successful
-	ctx, cancel := context.WithTimeout(context.Background(), timeout+5*time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(5*time.Second))
 	defer cancel()
 
-	select {
-	// Handle client cancellations
-	case <-r.Context().Done():
-		req.Invalidate()
-		if prometheusEnabled {
-			metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.Endpoint, 499)
+	for attempt := 1; ; attempt++ {
+		// Fail fast while Riot is having an outage, instead of burning tokens on requests that will fail anyway
+		if allowed, retryAt := rl.breakers.Allow(syntax, time.Now()); !allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(time.Until(retryAt).Seconds()))))
+			rl.setAttempts(w, attempt)
+			http.Error(w, "Circuit breaker open", http.StatusServiceUnavailable)
+			if prometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, http.StatusServiceUnavailable)
+			}
+			return forwardServed
 		}
 
-	// The request timed out (internally)
-	case <-ctx.Done():
-		// fmt.Println("ctx cancelled")
-		http.Error(w, "Request dropped due to timeout", http.StatusTooManyRequests)
-		if prometheusEnabled {
-			metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.Endpoint, 408)
+		// Enqueue request
+		select {
+		case rl.incomingChannel <- IncomingRequest{
+			Request:  req,
+			Syntax:   syntax,
+			Priority: priority,
+		}:
+		case <-rl.done:
+			rl.setAttempts(w, attempt)
+			http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+			if prometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, http.StatusServiceUnavailable)
+			}
+			return forwardServed
 		}
 
-	// The request is allowed to be executed
-	case response := <-req.Response:
-		// Record the start time, add a small buffer to avoid hitting the next window on accident
-		// startTime := time.Now().Add(time.Millisecond * -5)
+		var response *request.ResponseChannel
+
+		select {
+		// Handle client cancellations
+		case <-r.Context().Done():
+			rl.abandonRequest(req, syntax)
+			if prometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 499)
+			}
+			return forwardAbandoned
+
+		// The request timed out (internally)
+		case <-ctx.Done():
+			// fmt.Println("ctx cancelled")
+			rl.abandonRequest(req, syntax)
+			rl.setAttempts(w, attempt)
+			http.Error(w, "Request dropped due to timeout", http.StatusTooManyRequests)
+			rl.updateTenantRequests(req.Tenant, "timeout")
+			if prometheusEnabled {
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 408)
+			}
+			return forwardAbandoned
+
+		// The request is allowed to be executed
+		case response = <-req.Response:
+		}
 
 		if response.KeyId == request.RequestFailed {
 			if response.RetryAfter != nil {
-				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(time.Until(*response.RetryAfter).Round(time.Second).Seconds())))
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(max(time.Until(*response.RetryAfter), 0).Seconds()))))
+			}
+
+			// Flushed or paused by an admin, coalesced requests share the outcome
+			if response.Status != 0 {
+				message := "Request flushed from the queue"
+				if response.Paused {
+					message = "Requests are paused"
+				}
+
+				rl.setAttempts(w, attempt)
+				http.Error(w, message, response.Status)
+				rl.updateTenantRequests(req.Tenant, "rejected")
+				if prometheusEnabled {
+					metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, response.Status)
+				}
+				return forwardServed
 			}
+
 			// fmt.Println("timeout exceeded")
+			rl.setAttempts(w, attempt)
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			rl.updateTenantRequests(req.Tenant, "rejected")
 			if prometheusEnabled {
-				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.Endpoint, 430)
+				metrics.UpdateResponseCodes(configs.DEFAULT_NO_KEY, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 430)
 			}
-			return
+			return forwardAbandoned
+		}
+
+		rl.updateTenantRequests(req.Tenant, "dispatched")
+
+		riotApiRequest, err := rl.riotApiRequest(syntax, r.URL.Query(), body, r.Header.Get("Content-Type"), response.KeyId)
+		if !errors.Is(err, errRequestNotSent) {
+			dispatched = true
 		}
 
-		riotApiRequest, err := rl.riotApiRequest(syntax.Platform, syntax.Method, r.URL.Query(), response.KeyId)
 		if err != nil {
-			log.Println(err)
-			w.Header().Set("Retry-After", "0")
-			http.Error(w, "Failed to make API request", http.StatusInternalServerError)
+			if client := requestClient(r); client != "" {
+				log.Printf("Request of client %s failed: %v\n", client, err)
+			} else {
+				log.Println(err)
+			}
+			rl.breakers.Report(syntax, false, time.Now())
 
 			if prometheusEnabled {
-				metrics.UpdateResponseCodes(rl.opts.ApiKeys[response.KeyId].Name, syntax.Platform, syntax.Endpoint, 500)
+				metrics.UpdateResponseCodes(rl.opts.ApiKeys[response.KeyId].Name, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, 500)
 			}
-			// rl.refundRequest(syntax, priority, response.KeyId, startTime)
-			return
+
+			// Riot never saw the request, so the token can be used again
+			notSent := errors.Is(err, errRequestNotSent)
+			if notSent {
+				rl.refundRequest(syntax, response.KeyId, response.AllowedAt, RefundNotSent)
+			}
+
+			if (notSent || isIdempotent(syntax.HttpMethod)) && rl.retryRequest(r, req, attempt, nil) {
+				req = request.NewRetryRequest(req)
+				continue
+			}
+
+			w.Header().Set("Retry-After", "0")
+			rl.setAttempts(w, attempt)
+			http.Error(w, "Failed to make API request", http.StatusInternalServerError)
+			return forwardServed
 		}
 
 		// Report prometheus statistics, if enabled
 		if prometheusEnabled {
-			metrics.UpdateResponseCodes(rl.opts.ApiKeys[response.KeyId].Name, syntax.Platform, syntax.Endpoint, riotApiRequest.StatusCode)
+			metrics.UpdateResponseCodes(rl.opts.ApiKeys[response.KeyId].Name, syntax.Platform, syntax.HttpMethod, syntax.Endpoint, riotApiRequest.StatusCode)
 		}
-		defer riotApiRequest.Body.Close()
 
-		if riotApiRequest.StatusCode == http.StatusTooManyRequests || (response.Update && riotApiRequest.StatusCode == http.StatusOK) {
+		rl.breakers.Report(syntax, !isRetryableStatus(riotApiRequest.StatusCode), time.Now())
+		rl.reportKeyStatus(response.KeyId, riotApiRequest.StatusCode)
+
+		if riotApiRequest.StatusCode == http.StatusTooManyRequests || riotApiRequest.StatusCode == http.StatusServiceUnavailable || (response.Update && riotApiRequest.StatusCode == http.StatusOK) {
 			rl.updateRatelimits(syntax, riotApiRequest, response.KeyId, priority)
 		}
-		// else if riotApiRequest.StatusCode >= 500 {
-		// 	rl.refundRequest(syntax, priority, response.KeyId, startTime)
-		// }
+
+		if isRetryableStatus(riotApiRequest.StatusCode) && isIdempotent(syntax.HttpMethod) && rl.retryRequest(r, req, attempt, riotApiRequest) {
+			riotApiRequest.Body.Close()
+			req = request.NewRetryRequest(req)
+			continue
+		}
+
+		defer riotApiRequest.Body.Close()
 
 		// Copy relevant headers from Riot API response to our response
 		importantHeaders := []string{
@@ -144,20 +318,58 @@ func (rl *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		w.Header().Set("X-Key", fmt.Sprintf("%d", response.KeyId+1))
+		rl.setAttempts(w, attempt)
+		if req.EstimatedWait >= 0 {
+			w.Header().Set("X-Estimated-Wait", fmt.Sprintf("%d", req.EstimatedWait.Milliseconds()))
+		}
+
+		if cacheable || storable {
+			w.Header().Set("X-Cache", "MISS")
+
+			// The body has to be read completely to be cached
+			responseBody, err := io.ReadAll(riotApiRequest.Body)
+			if err != nil {
+				log.Printf("Error reading response: %v", err)
+				http.Error(w, "Failed to read API response", http.StatusBadGateway)
+				return forwardServed
+			}
+
+			if cacheable {
+				rl.cacheResponse(key, cacheTTL, riotApiRequest, responseBody)
+			}
+
+			if storable {
+				rl.storeResponse(key, riotApiRequest, responseBody)
+			}
+
+			w.WriteHeader(riotApiRequest.StatusCode)
+			if _, err := w.Write(responseBody); err != nil {
+				log.Printf("Error writing response: %v", err)
+			}
+			return forwardServed
+		}
 
 		// Write response 1:1 to keep gzip
 		w.WriteHeader(riotApiRequest.StatusCode)
 		if _, err := io.Copy(w, riotApiRequest.Body); err != nil {
 			log.Printf("Error writing response: %v", err)
 		}
+		return forwardServed
 	}
 }
 
-// func (rl *RateLimiter) refundRequest(syntax *schema.Syntax, priority request.Priority, keyId int, timestamp time.Time) {
-// 	rl.refundChannel <- Refund{
-// 		Syntax:      syntax,
-// 		Priority:    priority,
-// 		KeyId:       keyId,
-// 		RequestTime: timestamp,
-// 	}
-// }
+/*
+INTERNAL:
+Abandons a request the client is no longer waiting for. If a key was already handed out, its token is refunded
+*/
+func (rl *RateLimiter) abandonRequest(req *request.Request, syntax *schema.Syntax) {
+	if req.Abandon() {
+		return
+	}
+
+	// The main loop delivered a response right before, the channel is buffered, so this doesn't block
+	response := <-req.Response
+	if response.KeyId != request.RequestFailed {
+		rl.refundRequest(syntax, response.KeyId, response.AllowedAt, RefundAbandoned)
+	}
+}
@@ -1,18 +1,28 @@
 package ratelimiter
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"sync/atomic"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
 )
 
-func (rl *RateLimiter) riotApiRequest(region string, method string, queryParams url.Values, keyId int) (*http.Response, error) {
+// Returned if a request failed before it was written to Riot, so it didn't count towards any rate limit
+var errRequestNotSent = errors.New("request was not sent")
+
+func (rl *RateLimiter) riotApiRequest(syntax *schema.Syntax, queryParams url.Values, body []byte, contentType string, keyId int) (*http.Response, error) {
 	// prepare the request
 	// append the api key as a header
 
 	// build uri with region, method, and query parameters
-	uri := "https://" + region + ".api.riotgames.com/" + method + "?" + queryParams.Encode()
+	uri := "https://" + syntax.Platform + ".api.riotgames.com/" + syntax.Method + "?" + queryParams.Encode()
 
-	req, err := http.NewRequest("GET", uri, nil)
+	req, err := http.NewRequest(syntax.HttpMethod, uri, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -21,8 +31,26 @@ func (rl *RateLimiter) riotApiRequest(region string, method string, queryParams
 	req.Header.Set("X-Riot-Token", rl.opts.ApiKeys[keyId].ApiKey)
 	req.Header.Set("Accept-Encoding", "gzip") // accept gzip
 
+	// Forward the content type of write requests, e.g. tournament-v5
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Track whether the request was written, the transport calls this from another goroutine
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				sent.Store(true)
+			}
+		},
+	}))
+
 	resp, err := rl.client.Do(req)
 	if err != nil {
+		if !sent.Load() {
+			return nil, fmt.Errorf("%w: %w", errRequestNotSent, err)
+		}
 		return nil, err
 	}
 
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
+)
+
+// Upstream failures which are worth another attempt
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// Requests which can be repeated without side effects. Other requests are only retried if they were never sent
+func isIdempotent(httpMethod string) bool {
+	switch httpMethod {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+/*
+INTERNAL:
+Decides whether a failed attempt is retried and waits for the backoff if so.
+Retries are skipped if they are disabled, exhausted or can't be served before the request's deadline.
+The response is nil if the request failed before Riot answered.
+*/
+func (rl *RateLimiter) retryRequest(r *http.Request, req *request.Request, attempt int, response *http.Response) bool {
+	if attempt > rl.opts.MaxRetries {
+		return false
+	}
+
+	// Exponential backoff, unless Riot tells us how long to wait
+	backoff := configs.RETRY_BACKOFF_BASE << (attempt - 1)
+	if response != nil {
+		if ra := response.Header.Get("Retry-After"); ra != "" {
+			if seconds, err := strconv.Atoi(ra); err == nil && seconds >= 0 {
+				backoff = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	// The retry has to be queued and executed before the original deadline
+	if time.Now().Add(backoff).UnixMilli() >= req.Expire {
+		return false
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Exposes the amount of attempts to the client if retries are enabled
+func (rl *RateLimiter) setAttempts(w http.ResponseWriter, attempts int) {
+	if rl.opts.MaxRetries > 0 {
+		w.Header().Set("X-Attempts", fmt.Sprintf("%d", attempts))
+	}
+}
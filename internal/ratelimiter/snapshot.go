@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/queue"
+)
+
+/*
+INTERNAL:
+Restores the rate limits from the snapshot file if it exists and isn't older than the configured max age
+*/
+func (rl *RateLimiter) loadSnapshot() {
+	path := rl.opts.SnapshotPath
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read rate limit snapshot %s: %v\n", path, err)
+		}
+		return
+	}
+
+	var snapshot queue.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		log.Printf("Failed to decode rate limit snapshot %s: %v\n", path, err)
+		return
+	}
+
+	age := time.Since(snapshot.CreatedAt)
+	if age > rl.opts.SnapshotMaxAge {
+		log.Printf("Ignoring rate limit snapshot %s, it is %s old\n", path, age.Round(time.Second))
+		return
+	}
+
+	restored := rl.queueManager.Restore(&snapshot)
+	log.Printf("Restored rate limits of %d key(s) from snapshot %s (%s old)\n", restored, path, age.Round(time.Second))
+}
+
+/*
+INTERNAL:
+Writes a snapshot to disk. The file is replaced atomically, so a crash never leaves a partially written snapshot behind
+*/
+func (rl *RateLimiter) writeSnapshot(snapshot *queue.Snapshot) {
+	rl.snapshotMu.Lock()
+	defer rl.snapshotMu.Unlock()
+
+	// A periodic write might finish after the shutdown write, don't overwrite newer state
+	if snapshot.CreatedAt.Before(rl.lastSnapshot) {
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Printf("Failed to encode rate limit snapshot: %v\n", err)
+		return
+	}
+
+	path := rl.opts.SnapshotPath
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Printf("Failed to write rate limit snapshot %s: %v\n", path, err)
+		return
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		log.Printf("Failed to write rate limit snapshot %s: %v\n", path, err)
+		return
+	}
+
+	rl.lastSnapshot = snapshot.CreatedAt
+}
@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+/*
+INTERNAL:
+Returns whether responses of the request are kept in the response store. Only GET requests of configured endpoints are stored
+*/
+func (rl *RateLimiter) storable(syntax *schema.Syntax) bool {
+	if rl.opts.ResponseStore == nil || syntax.HttpMethod != http.MethodGet {
+		return false
+	}
+
+	return slices.Contains(rl.opts.StoreEndpoints, syntax.Endpoint)
+}
+
+/*
+INTERNAL:
+Serves a response from the response store, if it exists. Records hits and misses
+*/
+func (rl *RateLimiter) serveStored(w http.ResponseWriter, syntax *schema.Syntax, key string) bool {
+	response, Ok := rl.opts.ResponseStore.Get(key)
+
+	if rl.opts.PrometheusEnabled {
+		metrics.UpdateStoreRequests(syntax.Platform, syntax.HttpMethod, syntax.Endpoint, Ok)
+	}
+
+	if !Ok {
+		return false
+	}
+
+	writeHit(w, response.StatusCode, response.Header, response.Body)
+	return true
+}
+
+/*
+INTERNAL:
+Stores successful responses in the background. Other responses might change, so they are not stored.
+Storing is best effort, responses are skipped while too many writes are pending
+*/
+func (rl *RateLimiter) storeResponse(key string, response *http.Response, body []byte) {
+	if response.StatusCode != http.StatusOK {
+		return
+	}
+
+	select {
+	case rl.storeWrites <- struct{}{}:
+	default:
+		return
+	}
+
+	stored := &options.StoredResponse{
+		StatusCode: response.StatusCode,
+		Header:     cachedHeader(response, body),
+		Body:       body,
+	}
+
+	// Writing to disk doesn't delay the response
+	go func() {
+		defer func() { <-rl.storeWrites }()
+
+		if err := rl.opts.ResponseStore.Put(key, stored); err != nil {
+			log.Printf("Failed to store response: %v\n", err)
+		}
+	}()
+}
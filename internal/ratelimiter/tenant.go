@@ -0,0 +1,73 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/metrics"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+/*
+INTERNAL:
+Returns the tenant of a request, which is the authenticated client or set in the configured tenant header.
+Requests without tenants share one lane of each queue. Clients choose the header freely, so unknown tenants
+share the "*" tenant and can't create new lanes
+*/
+func (rl *RateLimiter) requestTenant(r *http.Request) string {
+	if rl.auth != nil {
+		return requestClient(r)
+	}
+
+	if rl.opts.Tenants.Header == "" {
+		return ""
+	}
+
+	tenant := strings.TrimSpace(r.Header.Get(rl.opts.Tenants.Header))
+	if _, Ok := rl.opts.Tenants.Tenants[tenant]; !Ok {
+		return "*"
+	}
+
+	return tenant
+}
+
+// INTERNAL: Counts the outcome of a queued request for its tenant
+func (rl *RateLimiter) updateTenantRequests(tenant string, result string) {
+	if rl.opts.PrometheusEnabled && rl.opts.TenantsEnabled() {
+		metrics.UpdateTenantRequests(rl.opts.TenantLabel(tenant), result)
+	}
+}
+
+/*
+INTERNAL:
+Spends a token of the tenant's quota before the request is queued. Rejects the request with 429 and the time until the tenant's window is over,
+if the quota is exhausted. Returns when the token was taken, zero if there is nothing to refund, and whether the request may continue
+*/
+func (rl *RateLimiter) takeQuota(w http.ResponseWriter, syntax *schema.Syntax, tenant string) (time.Time, bool) {
+	if !rl.opts.TenantsEnabled() {
+		return time.Time{}, true
+	}
+
+	now := time.Now()
+	allowed, remaining, retryAt := rl.quotas.Take(tenant, syntax, now)
+	if remaining >= 0 {
+		w.Header().Set("X-Tenant-Quota-Remaining", strconv.Itoa(remaining))
+	}
+
+	if !allowed {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(time.Until(retryAt).Seconds()))))
+		http.Error(w, "Tenant quota exceeded", http.StatusTooManyRequests)
+		rl.updateTenantRequests(tenant, "quota_exceeded")
+		return time.Time{}, false
+	}
+
+	if remaining < 0 {
+		return time.Time{}, true
+	}
+
+	return now, true
+}
@@ -0,0 +1,36 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+INTERNAL:
+Returns the deadline of a request. Clients can set their own timeout with the X-Timeout header,
+either in seconds or as a duration such as "500ms". It is clamped to the configured bounds
+*/
+func (rl *RateLimiter) requestDeadline(r *http.Request, now time.Time) (time.Time, error) {
+	header := r.Header.Get("X-Timeout")
+	if header == "" {
+		return now.Add(rl.opts.Timeout), nil
+	}
+
+	var timeout time.Duration
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil {
+		timeout = time.Duration(seconds * float64(time.Second))
+	} else if duration, err := time.ParseDuration(header); err == nil {
+		timeout = duration
+	} else {
+		return now, fmt.Errorf("Invalid X-Timeout header %q", header)
+	}
+
+	timeout = min(max(timeout, rl.opts.MinTimeout), rl.opts.MaxTimeout)
+	if timeout <= 0 {
+		return now, fmt.Errorf("Invalid X-Timeout header %q", header)
+	}
+
+	return now.Add(timeout), nil
+}
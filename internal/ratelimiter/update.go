@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"log"
 	"math"
 	"net/http"
 	"time"
@@ -14,6 +15,7 @@ type LimitType int
 const (
 	PlatformLimit LimitType = iota
 	MethodLimit
+	ServiceLimit // Riot's service is limited or unavailable, neither the app nor the method limit was hit
 )
 
 type Update struct {
@@ -33,31 +35,37 @@ func (rl *RateLimiter) updateRatelimits(syntax *schema.Syntax, response *http.Re
 	var retryAfter *time.Time
 	var limitType LimitType
 
-	if response.StatusCode == http.StatusTooManyRequests {
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
 		if ra := response.Header.Get("Retry-After"); ra != "" {
 			if dur, err := time.ParseDuration(ra + "s"); err == nil {
 				t := time.Now().Add(dur)
 				retryAfter = &t
+			}
+		}
 
-				if rt := response.Header.Get("X-Rate-Limit-Type"); rt != "" {
-					switch rt {
-					case "platform":
-						limitType = PlatformLimit
-					case "method":
-						limitType = MethodLimit
-					}
-				}
+		// A 429 without a type is caused by Riot and must not lock our app limit
+		limitType = ServiceLimit
+		if response.StatusCode == http.StatusTooManyRequests {
+			switch response.Header.Get("X-Rate-Limit-Type") {
+			case "application", "platform":
+				limitType = PlatformLimit
+			case "method":
+				limitType = MethodLimit
 			}
 		}
 	}
 
-	rl.updateChannel <- Update{
+	// The rate limits are gone with the main loop, so the update is dropped after the shutdown
+	select {
+	case rl.updateChannel <- Update{
 		syntax:     syntax,
 		keyId:      keyId,
 		priority:   priority,
 		header:     &response.Header,
 		RetryAfter: retryAfter,
 		LimitType:  limitType,
+	}:
+	case <-rl.done:
 	}
 }
 
@@ -70,12 +78,23 @@ func (rl *RateLimiter) handleUpdateRequest(update Update) {
 	manager := rl.queueManager
 
 	// Set last updated to now, dunno if that even works
-	queue := manager.GetQueue(*update.syntax, update.priority)
-	limits := (*queue.Limits)[update.keyId]
+	groups, Ok := manager.RateLimitGroups[update.syntax.Id]
+	if !Ok || update.keyId < 0 || update.keyId >= len(*groups) {
+		return
+	}
+	limits := (*groups)[update.keyId]
+
+	// Service limits lock the method on the platform for all keys, the app and method limits stay untouched
+	if update.LimitType == ServiceLimit {
+		lockedUntil := limits.ServiceBackoff.Fail(time.Now(), update.RetryAfter)
+		log.Printf("Service limit hit for %s/%s, backing off until %s\n", update.syntax.Platform, update.syntax.Endpoint, lockedUntil.Format(time.RFC3339))
+	}
+
+	applyRetryAfter := update.LimitType != ServiceLimit
 
 	peakCapacity := math.Min(
-		limits.PlatformLimits.Update((*update.header).Get("X-App-Rate-Limit"), (*update.header).Get("X-App-Rate-Limit-Count"), update.RetryAfter, update.LimitType == PlatformLimit),
-		limits.MethodLimits.Update((*update.header).Get("X-Method-Rate-Limit"), (*update.header).Get("X-Method-Rate-Limit-Count"), update.RetryAfter, update.LimitType == MethodLimit),
+		limits.PlatformLimits.Update((*update.header).Get("X-App-Rate-Limit"), (*update.header).Get("X-App-Rate-Limit-Count"), update.RetryAfter, applyRetryAfter && update.LimitType == PlatformLimit),
+		limits.MethodLimits.Update((*update.header).Get("X-Method-Rate-Limit"), (*update.header).Get("X-Method-Rate-Limit-Count"), update.RetryAfter, applyRetryAfter && update.LimitType == MethodLimit),
 	)
 
 	if peakCapacity > 0 {
@@ -1,45 +1,113 @@
 package request
 
-import "time"
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Index of the priority class of a request, 0 is the highest priority
+type Priority int
 
-type Priority bool
+const RequestFailed = -1
 
+// States of a request. The main loop and the client race for the state, whoever swaps it first wins
 const (
-	NormalPriority Priority = false
-	HighPriority   Priority = true
-	RequestFailed           = -1
+	statePending int32 = iota
+	stateDelivered
+	stateAbandoned
 )
 
 type Request struct {
-	Expire      int64 // Expiration timestamp in milliseconds
-	Response    chan *ResponseChannel
-	Invalidated bool
+	Expire        int64 // Expiration timestamp in milliseconds
+	Created       int64 // Creation timestamp in milliseconds
+	Response      chan *ResponseChannel
+	EstimatedWait time.Duration // Set by the main loop when the request is queued, read it after a response was received. Negative if unknown
+	Tenant        string        // Client the request is queued for, empty without tenants
+	state         atomic.Int32
 }
 
 type ResponseChannel struct {
 	KeyId      int
 	Update     bool
 	RetryAfter *time.Time // Optional
+	Status     int        // Status of a failed response, if it was flushed from the queue or paused
+	Paused     bool       // The method is paused on every key
+	AllowedAt  time.Time  // Time the rate limit was consumed, required to refund it
 }
 
 // NewRequest creates a new request with an expiration time
 func NewRequest(expire time.Duration) *Request {
+	now := time.Now()
+	return &Request{
+		Expire:   now.Add(expire).UnixMilli(),
+		Created:  now.UnixMilli(),
+		Response: make(chan *ResponseChannel, 1), // A buffer size of 1 to avoid blocking
+	}
+}
+
+// NewRetryRequest creates a new request for another attempt, keeping the expiration and creation time of the original request
+func NewRetryRequest(original *Request) *Request {
 	return &Request{
-		Expire:      time.Now().Add(expire).UnixMilli(),
-		Response:    make(chan *ResponseChannel, 1), // A buffer size of 1 to avoid blocking
-		Invalidated: false,
+		Expire:   original.Expire,
+		Created:  original.Created,
+		Response: make(chan *ResponseChannel, 1),
+		Tenant:   original.Tenant,
 	}
 }
 
-func (r *Request) Invalidate() {
-	r.Invalidated = true
+/*
+Marks the request as abandoned by the client.
+Returns false if a response was already delivered, which then has to be read from the response channel.
+*/
+func (r *Request) Abandon() bool {
+	return r.state.CompareAndSwap(statePending, stateAbandoned)
+}
+
+// Invalidated returns whether the client abandoned the request
+func (r *Request) Invalidated() bool {
+	return r.state.Load() == stateAbandoned
+}
+
+/*
+Delivers a response to the client, if it didn't abandon the request yet.
+Returns false if the response was not delivered.
+*/
+func (r *Request) Deliver(response *ResponseChannel) bool {
+	if !r.state.CompareAndSwap(statePending, stateDelivered) {
+		return false
+	}
+
+	r.Response <- response
+	return true
 }
 
 // FailedResponse sends a failed response to the requests response channel.
 func (r *Request) FailedResponse(time *time.Time) {
-	r.Response <- &ResponseChannel{
+	r.Deliver(&ResponseChannel{
 		KeyId:      RequestFailed,
 		Update:     false,
 		RetryAfter: time,
-	}
+	})
+}
+
+// FlushedResponse sends a failed response with the given status, after the request was flushed from its queue.
+func (r *Request) FlushedResponse(status int, time *time.Time) {
+	r.Deliver(&ResponseChannel{
+		KeyId:      RequestFailed,
+		Update:     false,
+		RetryAfter: time,
+		Status:     status,
+	})
+}
+
+// PausedResponse sends a failed response with 503, as the requested method is paused on every key.
+func (r *Request) PausedResponse(time *time.Time) {
+	r.Deliver(&ResponseChannel{
+		KeyId:      RequestFailed,
+		Update:     false,
+		RetryAfter: time,
+		Status:     http.StatusServiceUnavailable,
+		Paused:     true,
+	})
 }
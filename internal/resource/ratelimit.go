@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"fmt"
 	"log"
 	"math"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 )
 
 type RateLimit struct {
@@ -111,6 +113,8 @@ func (rlc *RateLimitCategory) Update(limit string, count string, retryAfter *tim
 		}
 	}
 
+	rlc.Placeholder = false
+
 	if applyRetryAfter && retryAfter != nil {
 		log.Println("Applying Retry-After:", (*retryAfter).Format(time.RFC3339))
 		rlc.LockedUntil = (*retryAfter)
@@ -130,6 +134,81 @@ func (rlc *RateLimitCategory) Update(limit string, count string, retryAfter *tim
 
 }
 
+/*
+Parses limits in the format of Riot's rate limit headers, e.g. "20:1,100:120", in order to seed a category before any header was received
+*/
+func ParseRateLimits(limit string, additionalWindowSize time.Duration, now time.Time) ([]*RateLimit, error) {
+	rateLimits := []*RateLimit{}
+
+	for _, value := range strings.Split(limit, ",") {
+		split := strings.SplitN(strings.TrimSpace(value), ":", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %q, expected <limit>:<window>", value)
+		}
+
+		capacity, err := strconv.Atoi(split[0])
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("invalid limit in rate limit %q", value)
+		}
+
+		window, err := strconv.Atoi(split[1])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window in rate limit %q", value)
+		}
+
+		rateLimits = append(rateLimits, &RateLimit{
+			Window:     getDurationFromWindow(window, additionalWindowSize),
+			Limit:      int(float64(capacity) * configs.MAX_UTILIZATION_FACTOR),
+			Current:    0,
+			LastRefill: now,
+		})
+	}
+
+	return rateLimits, nil
+}
+
+/*
+INTERNAL:
+Returns how many requests of the priority class the limit allows from now until t, assuming no other requests use it.
+Mirrors TryAllow: a window starts with its first request and smoothed requests are spread across the window
+*/
+func (rl *RateLimit) availableUntil(now time.Time, t time.Time, class options.PriorityClass) int64 {
+	limit := int64(rl.usable(class.Reserve))
+	if rl.Window <= 0 || limit <= 0 {
+		return 0
+	}
+
+	lastRefill, current := rl.LastRefill, rl.Current
+	// The window is over, it is refilled with the next request
+	if !now.Before(lastRefill.Add(rl.Window)) {
+		lastRefill, current = now, 0
+	}
+
+	elapsed := t.Sub(lastRefill)
+	if elapsed < 0 {
+		return 0
+	}
+
+	windows := int64(elapsed / rl.Window)
+
+	inWindow := limit
+	if !class.Burst {
+		progress := float64(elapsed-time.Duration(windows)*rl.Window) / float64(rl.Window)
+		inWindow = min(int64(progress*float64(limit))+2, limit)
+	}
+
+	return max(0, windows*limit+inWindow-int64(current))
+}
+
+/*
+INTERNAL:
+Returns how many requests of the window a priority class may use. The reserved share is rounded down,
+so small limits stay usable for every class
+*/
+func (rl *RateLimit) usable(reserve float32) int {
+	return rl.Limit - int(float32(rl.Limit)*reserve)
+}
+
 func getDurationFromWindow(window int, additionalWindowSize time.Duration) time.Duration {
 	return time.Duration(window)*time.Second + additionalWindowSize
 }
@@ -1,10 +1,49 @@
 package resource
 
-import "time"
+import (
+	"math"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
 
 type RateLimitCategory struct {
 	LockedUntil          time.Time
 	RateLimits           []*RateLimit
 	AdditionalWindowSize *time.Duration
 	Timeout              *time.Duration
+	Placeholder          bool // the limits are a guess until Riot reports them
+}
+
+// Returns the amount of requests the strictest limit allows within the timeout
+func (rlc *RateLimitCategory) PeakCapacity() float64 {
+	peakCapacity := float64(0)
+	for _, ratelimit := range rlc.RateLimits {
+		currentPeakCapacity := float64(ratelimit.Limit) / float64(ratelimit.Window) * float64(*rlc.Timeout)
+
+		if peakCapacity == 0 {
+			peakCapacity = currentPeakCapacity
+		} else {
+			peakCapacity = math.Min(peakCapacity, currentPeakCapacity)
+		}
+	}
+
+	return peakCapacity
+}
+
+/*
+Returns how many requests the category allows from now until t, assuming no other requests use it.
+A lock that lasts beyond t allows nothing
+*/
+func (rlc *RateLimitCategory) availableUntil(now time.Time, t time.Time, class options.PriorityClass) int64 {
+	if rlc.LockedUntil.After(t) {
+		return 0
+	}
+
+	available := int64(math.MaxInt64)
+	for _, ratelimit := range rlc.RateLimits {
+		available = min(available, ratelimit.availableUntil(now, t, class))
+	}
+
+	return available
 }
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/DarkIntaqt/cosmic-radiance/configs"
-	"github.com/DarkIntaqt/cosmic-radiance/internal/request"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 )
 
 type RateLimitGroupSlice = []*RateLimitGroup
@@ -13,9 +13,12 @@ type RateLimitGroupSlice = []*RateLimitGroup
 type RateLimitGroup struct {
 	PlatformLimits *RateLimitCategory
 	MethodLimits   *RateLimitCategory
+	ServiceBackoff *ServiceBackoff // shared by the groups of all keys
 	KeyId          int
+	Platform       string
 	LastUpdated    time.Time
 	PeakCapacity   int64
+	PausedUntil    time.Time // paused by the admin API
 	// TotalRequests  int64 // counter of total requests for analytics
 }
 
@@ -32,10 +35,19 @@ func (rlg *RateLimitGroup) NeedsUpdate(now time.Time) bool {
 }
 
 /*
-Tries to allow a request through the rate limit.
-If the request is allowed, it consumes the available quota.
+Tries to allow a request of the priority class through the rate limit.
+If the request is allowed, it consumes the available quota. Requests are spread across the window unless the class bursts,
+and can't consume the share of each limit the class reserves for higher classes
 */
-func (rlg *RateLimitGroup) TryAllow(now time.Time, priority request.Priority) bool {
+func (rlg *RateLimitGroup) TryAllow(now time.Time, class options.PriorityClass) bool {
+	if rlg.PausedUntil.After(now) {
+		return false
+	}
+
+	if rlg.ServiceBackoff != nil && rlg.ServiceBackoff.LockedUntil.After(now) {
+		return false
+	}
+
 	if rlg.PlatformLimits.LockedUntil.After(now) || rlg.MethodLimits.LockedUntil.After(now) {
 		return false
 	}
@@ -44,17 +56,18 @@ func (rlg *RateLimitGroup) TryAllow(now time.Time, priority request.Priority) bo
 	for i := range rlg.PlatformLimits.RateLimits {
 		rl := rlg.PlatformLimits.RateLimits[i]
 
-		if rl.Current >= rl.Limit {
+		limit := rl.usable(class.Reserve)
+		if rl.Current >= limit {
 			return false
 		}
 
-		if priority == request.HighPriority {
+		if class.Burst {
 			continue
 		}
 
 		// Compute how many requests should have been allowed by now ideally
 		elapsed := now.Sub(rl.LastRefill)
-		idealAllowed := int(math.Min(float64(elapsed)/float64(rl.Window)*float64(rl.Limit)+1, float64(rl.Limit)))
+		idealAllowed := int(math.Min(float64(elapsed)/float64(rl.Window)*float64(limit)+1, float64(limit)))
 
 		if rl.Current > idealAllowed {
 			return false
@@ -64,17 +77,18 @@ func (rlg *RateLimitGroup) TryAllow(now time.Time, priority request.Priority) bo
 	for i := range rlg.MethodLimits.RateLimits {
 		rl := rlg.MethodLimits.RateLimits[i]
 
-		if rl.Current >= rl.Limit {
+		limit := rl.usable(class.Reserve)
+		if rl.Current >= limit {
 			return false
 		}
 
-		if priority == request.HighPriority {
+		if class.Burst {
 			continue
 		}
 
 		// Compute how many requests should have been allowed by now ideally
 		elapsed := now.Sub(rl.LastRefill)
-		idealAllowed := int(math.Min(float64(elapsed)/float64(rl.Window)*float64(rl.Limit)+1, float64(rl.Limit)))
+		idealAllowed := int(math.Min(float64(elapsed)/float64(rl.Window)*float64(limit)+1, float64(limit)))
 
 		if rl.Current > idealAllowed {
 			return false
@@ -104,20 +118,45 @@ func (rlg *RateLimitGroup) TryAllow(now time.Time, priority request.Priority) bo
 	return true
 }
 
-// Refund is the inverse function of TryAllow and decreases the currently used rate limit by one
-func (rlg *RateLimitGroup) Refund(now time.Time) {
-	// Decrease all limits by one only if still within the same window
+/*
+Refund is the inverse function of TryAllow and decreases the currently used rate limit by one.
+Limits are only decreased if they are still in the window the request was allowed in, otherwise the token already expired.
+*/
+func (rlg *RateLimitGroup) Refund(allowedAt time.Time, now time.Time) bool {
+	refunded := false
+
 	for i := range rlg.PlatformLimits.RateLimits {
 		rl := rlg.PlatformLimits.RateLimits[i]
-		if rl.Current > 0 && rl.LastRefill.Add(rl.Window).After(now) {
+		if rl.Current > 0 && !rl.LastRefill.After(allowedAt) && rl.LastRefill.Add(rl.Window).After(now) {
 			rl.Current--
+			refunded = true
 		}
 	}
 
 	for i := range rlg.MethodLimits.RateLimits {
 		rl := rlg.MethodLimits.RateLimits[i]
-		if rl.Current > 0 && rl.LastRefill.Add(rl.Window).After(now) {
+		if rl.Current > 0 && !rl.LastRefill.After(allowedAt) && rl.LastRefill.Add(rl.Window).After(now) {
 			rl.Current--
+			refunded = true
 		}
 	}
+
+	return refunded
+}
+
+/*
+Returns how many requests the key allows from now until t, considering both the platform and the method limits.
+The platform limits are shared with other methods, so this is an upper bound
+*/
+func (rlg *RateLimitGroup) AvailableUntil(now time.Time, t time.Time, class options.PriorityClass) int64 {
+	if rlg.PausedUntil.After(t) || (rlg.ServiceBackoff != nil && rlg.ServiceBackoff.LockedUntil.After(t)) {
+		return 0
+	}
+
+	return min(rlg.PlatformLimits.availableUntil(now, t, class), rlg.MethodLimits.availableUntil(now, t, class))
+}
+
+// Returns whether the limits of the key were reported by Riot, seeded or restored
+func (rlg *RateLimitGroup) Known() bool {
+	return !rlg.PlatformLimits.Placeholder && !rlg.MethodLimits.Placeholder
 }
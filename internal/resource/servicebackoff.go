@@ -0,0 +1,46 @@
+package resource
+
+import (
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+)
+
+// Backoff of a method on a platform after Riot's service limit was hit or the service was unavailable.
+// The backoff is shared by all keys, since it's not caused by any of them
+type ServiceBackoff struct {
+	LockedUntil time.Time
+	Failures    int // consecutive failures
+	LastFailure time.Time
+}
+
+/*
+Locks the method on the platform for all keys. Without a Retry-After, the lock grows exponentially with consecutive failures.
+Returns the time until the method is locked
+*/
+func (sb *ServiceBackoff) Fail(now time.Time, retryAfter *time.Time) time.Time {
+	// Failures long ago don't count as consecutive anymore
+	if now.Sub(sb.LastFailure) > configs.SERVICE_BACKOFF_RESET {
+		sb.Failures = 0
+	}
+
+	sb.Failures++
+	sb.LastFailure = now
+
+	backoff := configs.SERVICE_BACKOFF_BASE
+	for i := 1; i < sb.Failures && backoff < configs.SERVICE_BACKOFF_MAX; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, configs.SERVICE_BACKOFF_MAX)
+
+	lockedUntil := now.Add(backoff)
+	if retryAfter != nil && retryAfter.After(lockedUntil) {
+		lockedUntil = *retryAfter
+	}
+
+	if lockedUntil.After(sb.LockedUntil) {
+		sb.LockedUntil = lockedUntil
+	}
+
+	return sb.LockedUntil
+}
@@ -7,3 +7,22 @@ type InvalidPathSyntaxError struct {
 func (e *InvalidPathSyntaxError) Error() string {
 	return "Invalid path syntax " + e.path
 }
+
+type InvalidParameterError struct {
+	name   string
+	value  string
+	reason string
+}
+
+func (e *InvalidParameterError) Error() string {
+	return "Invalid path parameter " + e.name + " \"" + e.value + "\", " + e.reason
+}
+
+type MethodNotAllowedError struct {
+	method  string
+	Allowed []string
+}
+
+func (e *MethodNotAllowedError) Error() string {
+	return "Method " + e.method + " not allowed"
+}
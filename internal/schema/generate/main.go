@@ -0,0 +1,142 @@
+/*
+Generates the route table which is embedded into the binary from the upstream OpenAPI spec of the Riot Games API.
+Only the fields the route table is built from are kept, the constraints of parameters are taken over as they are.
+Run it with go generate ./internal/schema, the upstream version is kept in info.version
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const upstreamSource = "https://www.mingweisamuel.com/riotapi-schema/openapi-3.0.0.min.json"
+
+type spec struct {
+	OpenAPI string          `json:"openapi"`
+	Info    info            `json:"info"`
+	Paths   map[string]path `json:"paths"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type path struct {
+	Platforms  []string    `json:"x-platforms-available,omitempty"`
+	Parameters []parameter `json:"parameters,omitempty"`
+	Get        *operation  `json:"get,omitempty"`
+	Post       *operation  `json:"post,omitempty"`
+	Put        *operation  `json:"put,omitempty"`
+	Delete     *operation  `json:"delete,omitempty"`
+	Patch      *operation  `json:"patch,omitempty"`
+}
+
+type operation struct {
+	OperationId string      `json:"operationId,omitempty"`
+	Parameters  []parameter `json:"parameters,omitempty"`
+}
+
+type parameter struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required,omitempty"`
+	Schema   struct {
+		Type    string `json:"type,omitempty"`
+		Format  string `json:"format,omitempty"`
+		Pattern string `json:"pattern,omitempty"`
+		Enum    []any  `json:"enum,omitempty"`
+	} `json:"schema"`
+}
+
+func main() {
+	source := flag.String("source", upstreamSource, "file path or URL of the upstream OpenAPI spec")
+	out := flag.String("out", "openapi-3.0.0.min.json", "file the reduced spec is written to")
+	flag.Parse()
+
+	data, err := read(*source)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *source, err)
+	}
+
+	var upstream spec
+	if err := json.Unmarshal(data, &upstream); err != nil {
+		log.Fatalf("Failed to decode %s: %v", *source, err)
+	}
+
+	if len(upstream.Paths) == 0 || upstream.Info.Version == "" {
+		log.Fatalf("%s is not a Riot Games API spec, it has no paths or no version", *source)
+	}
+
+	// Query, header and body parameters aren't validated, only path parameters are kept
+	for name, details := range upstream.Paths {
+		details.Parameters = pathParameters(details.Parameters)
+		for _, operation := range []*operation{details.Get, details.Post, details.Put, details.Delete, details.Patch} {
+			if operation != nil {
+				operation.Parameters = pathParameters(operation.Parameters)
+			}
+		}
+		upstream.Paths[name] = details
+	}
+
+	// Maps are encoded sorted by key, so the output only changes with the spec
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(upstream); err != nil {
+		log.Fatalf("Failed to encode the spec: %v", err)
+	}
+
+	if err := os.WriteFile(*out, buffer.Bytes(), 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+
+	log.Printf("Wrote %d paths of version %s to %s\n", len(upstream.Paths), upstream.Info.Version, *out)
+}
+
+func pathParameters(parameters []parameter) []parameter {
+	kept := []parameter{}
+	for _, parameter := range parameters {
+		if parameter.In == "path" {
+			kept = append(kept, parameter)
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+
+	return kept
+}
+
+func read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
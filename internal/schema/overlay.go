@@ -0,0 +1,67 @@
+package schema
+
+// Constraints of a path parameter the upstream spec doesn't describe
+type constraint struct {
+	Pattern string
+	Enum    []string
+}
+
+var (
+	puuid         = constraint{Pattern: "^[A-Za-z0-9_-]{78}$"}
+	rankedQueues  = constraint{Enum: []string{"RANKED_SOLO_5x5", "RANKED_FLEX_SR", "RANKED_FLEX_TT"}}
+	tiers         = constraint{Enum: []string{"DIAMOND", "EMERALD", "PLATINUM", "GOLD", "SILVER", "BRONZE", "IRON"}}
+	tiersWithApex = constraint{Enum: []string{"CHALLENGER", "GRANDMASTER", "MASTER", "DIAMOND", "EMERALD", "PLATINUM", "GOLD", "SILVER", "BRONZE", "IRON"}}
+	apexTiers     = constraint{Enum: []string{"MASTER", "GRANDMASTER", "CHALLENGER"}}
+	divisions     = constraint{Enum: []string{"I", "II", "III", "IV"}}
+)
+
+// Local constraints of parameters which mean the same on every path
+var namedOverlay = map[string]constraint{
+	"puuid":          puuid,
+	"encryptedPUUID": puuid,
+}
+
+/*
+Local constraints by path and parameter name, they are used instead of the named ones.
+The overlay is applied to every loaded spec, whether it is embedded or loaded from a source, so requests are validated the same way.
+Constraints of the spec itself win, the overlay only fills in what it leaves out
+*/
+var overlay = map[string]map[string]constraint{
+	"/riot/account/v1/active-shards/by-game/{game}/by-puuid/{puuid}":            {"game": {Enum: []string{"val", "lor"}}},
+	"/riot/account/v1/region/by-game/{game}/by-puuid/{puuid}":                   {"game": {Enum: []string{"lol", "tft"}}},
+	"/lol/league-exp/v4/entries/{queue}/{tier}/{division}":                      {"queue": rankedQueues, "tier": tiersWithApex, "division": divisions},
+	"/lol/league/v4/entries/{queue}/{tier}/{division}":                          {"queue": rankedQueues, "tier": tiers, "division": divisions},
+	"/lol/league/v4/challengerleagues/by-queue/{queue}":                         {"queue": rankedQueues},
+	"/lol/league/v4/grandmasterleagues/by-queue/{queue}":                        {"queue": rankedQueues},
+	"/lol/league/v4/masterleagues/by-queue/{queue}":                             {"queue": rankedQueues},
+	"/lol/challenges/v1/challenges/{challengeId}/leaderboards/by-level/{level}": {"level": apexTiers},
+	"/tft/league/v1/entries/{tier}/{division}":                                  {"tier": tiers, "division": divisions},
+	"/tft/league/v1/rated-ladders/{queue}/top":                                  {"queue": {Enum: []string{"RANKED_TFT_TURBO"}}},
+}
+
+/*
+INTERNAL:
+Fills in the pattern and enum of a path parameter from the overlay, if the spec doesn't describe them
+*/
+func withOverlay(path string, spec openAPIParameter) openAPIParameter {
+	local, Ok := overlay[path][spec.Name]
+	if !Ok {
+		local, Ok = namedOverlay[spec.Name]
+	}
+
+	if !Ok {
+		return spec
+	}
+
+	if spec.Schema.Pattern == "" {
+		spec.Schema.Pattern = local.Pattern
+	}
+
+	if len(spec.Schema.Enum) == 0 {
+		for _, value := range local.Enum {
+			spec.Schema.Enum = append(spec.Schema.Enum, value)
+		}
+	}
+
+	return spec
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A spec like the upstream one, which doesn't describe the constraints of the overlay
+const testSpec = `{
+	"openapi": "3.0.0",
+	"info": { "title": "Riot API", "version": "test" },
+	"paths": {
+		"/lol/summoner/v4/summoners/by-puuid/{encryptedPUUID}": {
+			"x-platforms-available": ["euw1"],
+			"get": { "parameters": [{ "name": "encryptedPUUID", "in": "path", "schema": { "type": "string" } }] }
+		},
+		"/lol/league/v4/entries/{queue}/{tier}/{division}": {
+			"x-platforms-available": ["euw1"],
+			"get": { "parameters": [
+				{ "name": "queue", "in": "path", "schema": { "type": "string" } },
+				{ "name": "tier", "in": "path", "schema": { "type": "string", "enum": ["GOLD"] } },
+				{ "name": "division", "in": "path", "schema": { "type": "string" } }
+			] }
+		}
+	}
+}`
+
+func newTestRouters(t *testing.T) map[string]*Router {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(path, []byte(testSpec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	routers := make(map[string]*Router)
+	for name, source := range map[string]string{"embedded": "", "source": path} {
+		router, err := NewRouter(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routers[name] = router
+	}
+
+	return routers
+}
+
+func TestOverlay(t *testing.T) {
+	validPUUID := strings.Repeat("a", 78)
+
+	tests := []struct {
+		name  string
+		path  string
+		valid bool
+	}{
+		{name: "valid puuid", path: "lol/summoner/v4/summoners/by-puuid/" + validPUUID, valid: true},
+		{name: "short puuid", path: "lol/summoner/v4/summoners/by-puuid/abc"},
+		{name: "valid league entry", path: "lol/league/v4/entries/RANKED_SOLO_5x5/GOLD/I", valid: true},
+		{name: "unknown queue", path: "lol/league/v4/entries/RANKED_ARAM/GOLD/I"},
+		{name: "unknown division", path: "lol/league/v4/entries/RANKED_SOLO_5x5/GOLD/V"},
+	}
+
+	for name, router := range newTestRouters(t) {
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				_, err := router.Match("euw1", http.MethodGet, test.path)
+
+				var parameterErr *InvalidParameterError
+				if test.valid && err != nil {
+					t.Fatalf("expected %s to be valid, got %v", test.path, err)
+				}
+				if !test.valid && !errors.As(err, &parameterErr) {
+					t.Fatalf("expected an invalid parameter for %s, got %v", test.path, err)
+				}
+			})
+		}
+	}
+}
+
+func TestOverlaySpecPrecedence(t *testing.T) {
+	router := newTestRouters(t)["source"]
+
+	// The spec only allows GOLD, the overlay would allow SILVER as well
+	if _, err := router.Match("euw1", http.MethodGet, "lol/league/v4/entries/RANKED_SOLO_5x5/SILVER/I"); err == nil {
+		t.Fatal("expected the enum of the spec to be used instead of the overlay")
+	}
+}
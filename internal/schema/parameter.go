@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type openAPIParameter struct {
+	Name   string `json:"name"`
+	In     string `json:"in"`
+	Schema struct {
+		Type    string `json:"type,omitempty"`
+		Format  string `json:"format,omitempty"`
+		Pattern string `json:"pattern,omitempty"`
+		Enum    []any  `json:"enum,omitempty"`
+	} `json:"schema"`
+}
+
+// Constraints of a path parameter as described by the OpenAPI spec
+type parameter struct {
+	Name    string
+	Type    string
+	Format  string
+	Pattern *regexp.Regexp
+	Enum    []string
+}
+
+/*
+INTERNAL:
+Compiles an OpenAPI path parameter. Patterns which can't be compiled are ignored
+*/
+func newParameter(spec openAPIParameter) *parameter {
+	param := &parameter{
+		Name:   spec.Name,
+		Type:   spec.Schema.Type,
+		Format: spec.Schema.Format,
+	}
+
+	if spec.Schema.Pattern != "" {
+		if pattern, err := regexp.Compile(spec.Schema.Pattern); err == nil {
+			param.Pattern = pattern
+		}
+	}
+
+	for _, value := range spec.Schema.Enum {
+		param.Enum = append(param.Enum, fmt.Sprint(value))
+	}
+
+	return param
+}
+
+/*
+INTERNAL:
+Checks a value against the type, pattern and enum of the parameter
+*/
+func (p *parameter) validate(value string) error {
+	switch p.Type {
+	case "integer":
+		bitSize := 64
+		if p.Format == "int32" {
+			bitSize = 32
+		}
+		if _, err := strconv.ParseInt(value, 10, bitSize); err != nil {
+			return &InvalidParameterError{name: p.Name, value: value, reason: "expected an integer"}
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return &InvalidParameterError{name: p.Name, value: value, reason: "expected a number"}
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return &InvalidParameterError{name: p.Name, value: value, reason: "expected a boolean"}
+		}
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(value) {
+		return &InvalidParameterError{name: p.Name, value: value, reason: "expected to match " + p.Pattern.String()}
+	}
+
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return &InvalidParameterError{name: p.Name, value: value, reason: "expected one of " + strings.Join(p.Enum, ", ")}
+	}
+
+	return nil
+}
+
+/*
+INTERNAL:
+Validates all parameter segments of a request method against the pattern's parameters
+*/
+func (m *method) validate(requestMethod string) error {
+	segments := strings.Split(requestMethod, "/")
+	for i, param := range m.Parameters {
+		if param == nil || i >= len(segments) {
+			continue
+		}
+
+		if err := param.validate(segments[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+INTERNAL:
+Maps the parameters of a pattern to the segments they appear in. Literal segments and parameters without a description stay nil
+*/
+func getSegmentParameters(path string, specs []openAPIParameter) []*parameter {
+	params := make(map[string]*parameter)
+	for _, spec := range specs {
+		if spec.In == "path" {
+			params[spec.Name] = newParameter(withOverlay(path, spec))
+		}
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	segmentParameters := make([]*parameter, len(segments))
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segmentParameters[i] = params[strings.Trim(segment, "{}")]
+		}
+	}
+
+	return segmentParameters
+}
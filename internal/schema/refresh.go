@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"log"
+	"sort"
+	"sync"
+)
+
+// Only one refresh may run at once, otherwise the diff could be computed against the wrong table
+var refreshMu sync.Mutex
+
+/*
+Fetches the OpenAPI spec from source and atomically swaps the current route table.
+Added and removed routes are logged. Queues stay valid, since ids only depend on the path and platform.
+*/
+func Refresh(source string) error {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	spec, err := readSource(source)
+	if err != nil {
+		return err
+	}
+
+	next, err := parseSpec(source, spec)
+	if err != nil {
+		return err
+	}
+
+	prev := table.Swap(next)
+
+	added, removed := diffPatterns(prev.patterns, next.patterns)
+	for _, route := range added {
+		log.Printf("Route added: %s\n", route)
+	}
+	for _, route := range removed {
+		log.Printf("Route removed: %s\n", route)
+	}
+
+	log.Printf("Refreshed route table from %s (version %s -> %s): %d added, %d removed\n", source, prev.version, next.version, len(added), len(removed))
+
+	return nil
+}
+
+/*
+INTERNAL:
+Returns all routes as <HTTP method> <platform>/<method> which are only present in next (added) or only present in prev (removed)
+*/
+func diffPatterns(prev allowedPattern, next allowedPattern) ([]string, []string) {
+	prevRoutes := flattenPatterns(prev)
+	nextRoutes := flattenPatterns(next)
+
+	added := []string{}
+	for route := range nextRoutes {
+		if _, Ok := prevRoutes[route]; !Ok {
+			added = append(added, route)
+		}
+	}
+
+	removed := []string{}
+	for route := range prevRoutes {
+		if _, Ok := nextRoutes[route]; !Ok {
+			removed = append(removed, route)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+func flattenPatterns(patterns allowedPattern) map[string]struct{} {
+	routes := make(map[string]struct{})
+	for platform, methods := range patterns {
+		for _, endpoint := range methods {
+			routes[endpoint.HttpMethod+" "+platform+"/"+endpoint.Method] = struct{}{}
+		}
+	}
+
+	return routes
+}
@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+/*
+Router matches requests against a route table. Path and proxy mode use the same matching,
+only the way the platform is determined differs.
+*/
+type Router struct {
+	table *atomic.Pointer[routeTable]
+}
+
+// Returns a router using the process wide route table, which is swapped on every refresh
+func DefaultRouter() *Router {
+	return &Router{
+		table: &table,
+	}
+}
+
+/*
+Creates a standalone router from the OpenAPI spec found at source, which is either a file path or a http(s) URL.
+Uses the embedded route table if source is empty. The router is not affected by refreshes.
+*/
+func NewRouter(source string) (*Router, error) {
+	if source == "" {
+		source = EmbeddedSource
+	}
+
+	spec, err := readSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := parseSpec(source, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	router := &Router{
+		table: &atomic.Pointer[routeTable]{},
+	}
+	router.table.Store(loaded)
+
+	return router, nil
+}
+
+/*
+Matches a request on a platform against the route table and validates its path parameters.
+Returns an InvalidPathSyntaxError, InvalidParameterError or MethodNotAllowedError if the request can't be served
+*/
+func (r *Router) Match(platform string, httpMethod string, path string) (*Syntax, error) {
+
+	// remove leading slash, if set
+	method := strings.TrimPrefix(path, "/")
+
+	// find the matching method in the compiled patterns of the platform
+	endpointPattern, allowed := r.table.Load().match(platform, httpMethod, method)
+	if allowed != nil {
+		return nil, &MethodNotAllowedError{method: httpMethod, Allowed: allowed}
+	}
+	if endpointPattern == nil {
+		return nil, &InvalidPathSyntaxError{path: platform + "/" + method}
+	}
+
+	// reject malformed parameters before they consume any rate limit
+	if err := endpointPattern.validate(method); err != nil {
+		return nil, err
+	}
+
+	return &Syntax{
+		Platform:   platform,
+		Method:     method,
+		HttpMethod: httpMethod,
+		Id:         endpointPattern.Id,
+		Endpoint:   endpointPattern.Method,
+	}, nil
+}
+
+// Returns the version of the router's route table
+func (r *Router) Version() string {
+	return r.table.Load().version
+}
+
+// Returns the source of the router's route table
+func (r *Router) Source() string {
+	return r.table.Load().source
+}
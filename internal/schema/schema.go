@@ -2,61 +2,215 @@ package schema
 
 import (
 	"crypto/md5"
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
 )
 
+// Snapshot of the Riot Games API route table which is compiled into the binary, generated from the upstream spec
+//
+//go:generate go run ./generate -out openapi-3.0.0.min.json
+//go:embed openapi-3.0.0.min.json
+var embeddedSpec []byte
+
 type OpenAPISummary struct {
-	Paths map[string]struct {
-		Platforms []string `json:"x-platforms-available,omitempty"`
-	} `json:"paths"`
+	Info struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths map[string]openAPIPath `json:"paths"`
+}
+
+type openAPIPath struct {
+	Platforms  []string           `json:"x-platforms-available,omitempty"`
+	Parameters []openAPIParameter `json:"parameters,omitempty"`
+	Get        *openAPIOperation  `json:"get,omitempty"`
+	Post       *openAPIOperation  `json:"post,omitempty"`
+	Put        *openAPIOperation  `json:"put,omitempty"`
+	Delete     *openAPIOperation  `json:"delete,omitempty"`
+	Patch      *openAPIOperation  `json:"patch,omitempty"`
+}
+
+type openAPIOperation struct {
+	Parameters []openAPIParameter `json:"parameters,omitempty"`
+}
+
+/*
+INTERNAL:
+Returns all operations of a path by their HTTP method
+*/
+func (p openAPIPath) operations() map[string]*openAPIOperation {
+	operations := map[string]*openAPIOperation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	}
+
+	for httpMethod, operation := range operations {
+		if operation == nil {
+			delete(operations, httpMethod)
+		}
+	}
+
+	return operations
 }
 
 type method struct {
-	Method string
-	Id     string
+	Method     string
+	HttpMethod string
+	Id         string
+	Parameters []*parameter // parameter constraints per segment, nil for literal segments
 }
 
 type allowedPattern map[string][]method
 
-var AllowedPattern = getAllowedPattern()
+// The route table is swapped as a whole, so readers never see a partially refreshed table
+type routeTable struct {
+	patterns allowedPattern
+	routes   map[string]*routeNode // compiled patterns per platform
+	source   string
+	version  string
+}
+
+var table atomic.Pointer[routeTable]
+
+func init() {
+	embedded, err := parseSpec(EmbeddedSource, embeddedSpec)
+	if err != nil {
+		panic("Failed to decode embedded OpenAPI spec: " + err.Error())
+	}
+
+	table.Store(embedded)
+}
 
 /*
-Parses internal patterns into allowedPattern which represents all available methods
+Replaces the embedded route table with the OpenAPI spec found at source.
+The source is either a file path or a http(s) URL.
 */
-func getAllowedPattern() allowedPattern {
+func Load(source string) error {
+	spec, err := readSource(source)
+	if err != nil {
+		return err
+	}
 
-	req, err := http.Get("https://www.mingweisamuel.com/riotapi-schema/openapi-3.0.0.min.json")
+	loaded, err := parseSpec(source, spec)
 	if err != nil {
-		panic("Failed to fetch OpenAPI spec: " + err.Error())
+		return err
 	}
 
-	defer req.Body.Close()
+	table.Store(loaded)
+	return nil
+}
+
+// Returns all available methods per platform of the current route table
+func AllowedPattern() allowedPattern {
+	return table.Load().patterns
+}
+
+// Returns the source of the current route table
+func Source() string {
+	return table.Load().source
+}
+
+// Returns the version of the current route table
+func Version() string {
+	return table.Load().version
+}
 
-	if req.StatusCode != http.StatusOK {
-		panic("Failed to fetch OpenAPI spec: " + req.Status)
+// Returns the amount of routes over all platforms
+func RouteCount() int {
+	count := 0
+	for _, methods := range AllowedPattern() {
+		count += len(methods)
 	}
 
+	return count
+}
+
+func parseSpec(source string, spec []byte) (*routeTable, error) {
 	var openAPISummary OpenAPISummary
-	if err := json.NewDecoder(req.Body).Decode(&openAPISummary); err != nil {
-		panic("Failed to decode OpenAPI spec: " + err.Error())
+	if err := json.Unmarshal(spec, &openAPISummary); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAPI spec: %w", err)
+	}
+
+	if len(openAPISummary.Paths) == 0 {
+		return nil, fmt.Errorf("OpenAPI spec from %s contains no paths", source)
 	}
 
+	patterns := getAllowedPattern(openAPISummary)
+
+	return &routeTable{
+		patterns: patterns,
+		routes:   compilePatterns(patterns),
+		source:   source,
+		version:  openAPISummary.Info.Version,
+	}, nil
+}
+
+/*
+Parses internal patterns into allowedPattern which represents all available methods
+*/
+func getAllowedPattern(openAPISummary OpenAPISummary) allowedPattern {
+	// Sort the paths, so the compiled route table doesn't depend on the map iteration order
+	paths := make([]string, 0, len(openAPISummary.Paths))
+	for path := range openAPISummary.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
 	allowedPatterns := allowedPattern{}
-	for path, details := range openAPISummary.Paths {
-		for _, platform := range details.Platforms {
+	for _, path := range paths {
+		details := openAPISummary.Paths[path]
+		operations := details.operations()
+
+		httpMethods := make([]string, 0, len(operations))
+		for httpMethod := range operations {
+			httpMethods = append(httpMethods, httpMethod)
+		}
+		sort.Strings(httpMethods)
 
-			hash := md5.Sum([]byte(path + platform))
-			id := fmt.Sprintf("%x", hash)
+		for _, httpMethod := range httpMethods {
+			// Parameters can be described on the path and on the operation itself
+			specs := append(slices.Clone(details.Parameters), operations[httpMethod].Parameters...)
+			parameters := getSegmentParameters(path, specs)
 
-			allowedPatterns[platform] = append(allowedPatterns[platform], method{
-				Method: strings.TrimPrefix(path, "/"),
-				Id:     id,
-			})
+			for _, platform := range details.Platforms {
+
+				// Every operation has its own method rate limit, hence the HTTP method is part of the id
+				hash := md5.Sum([]byte(httpMethod + path + platform))
+				id := fmt.Sprintf("%x", hash)
+
+				allowedPatterns[platform] = append(allowedPatterns[platform], method{
+					Method:     strings.TrimPrefix(path, "/"),
+					HttpMethod: httpMethod,
+					Id:         id,
+					Parameters: parameters,
+				})
+			}
 		}
 	}
 
 	return allowedPatterns
 }
+
+/*
+Compiles the patterns of every platform into a trie, so matching a request doesn't need to split every pattern again
+*/
+func compilePatterns(patterns allowedPattern) map[string]*routeNode {
+	routes := make(map[string]*routeNode, len(patterns))
+	for platform, methods := range patterns {
+		root := newRouteNode()
+		for i := range methods {
+			root.insert(strings.Split(methods[i].Method, "/"), &methods[i])
+		}
+		routes[platform] = root
+	}
+
+	return routes
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Source name of the route table that is compiled into the binary
+const EmbeddedSource = "embedded"
+
+/*
+INTERNAL:
+Reads the raw OpenAPI spec from a file path or a http(s) URL
+*/
+func readSource(source string) ([]byte, error) {
+	if source == "" || source == EmbeddedSource {
+		return embeddedSpec, nil
+	}
+
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	res, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OpenAPI spec: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OpenAPI spec: %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
@@ -1,8 +1,9 @@
 package schema
 
 type Syntax struct {
-	Platform string
-	Method   string
-	Endpoint string // Method without custom request parameters
-	Id       string
+	Platform   string
+	Method     string
+	HttpMethod string
+	Endpoint   string // Method without custom request parameters
+	Id         string
 }
@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+)
+
+// Compiled route patterns of a single platform. Each node represents one path segment
+type routeNode struct {
+	literals map[string]*routeNode
+	wildcard *routeNode         // {parameter} segment
+	methods  map[string]*method // patterns ending at this node by their HTTP method
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{
+		literals: make(map[string]*routeNode),
+		methods:  make(map[string]*method),
+	}
+}
+
+/*
+INTERNAL:
+Inserts a pattern into the trie. If the same pattern is inserted twice, the first one is kept
+*/
+func (n *routeNode) insert(segments []string, m *method) {
+	node := n
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if node.wildcard == nil {
+				node.wildcard = newRouteNode()
+			}
+			node = node.wildcard
+			continue
+		}
+
+		next, Ok := node.literals[segment]
+		if !Ok {
+			next = newRouteNode()
+			node.literals[segment] = next
+		}
+		node = next
+	}
+
+	if _, Ok := node.methods[m.HttpMethod]; !Ok {
+		node.methods[m.HttpMethod] = m
+	}
+}
+
+/*
+INTERNAL:
+Finds the node whose pattern matches all segments and which serves the HTTP method.
+Literal segments take precedence over wildcards, the wildcard branch is only taken if the literal branch doesn't lead to a pattern.
+If no node serves the HTTP method, the first node matching the path is returned as well
+*/
+func (n *routeNode) lookup(segments []string, httpMethod string) (*method, *routeNode) {
+	if len(segments) == 0 {
+		if len(n.methods) == 0 {
+			return nil, nil
+		}
+		return n.methods[httpMethod], n
+	}
+
+	segment := segments[0]
+	var pathMatch *routeNode
+
+	if next, Ok := n.literals[segment]; Ok {
+		m, node := next.lookup(segments[1:], httpMethod)
+		if m != nil {
+			return m, node
+		}
+		pathMatch = node
+	}
+
+	// Wildcards never match empty segments, e.g. trailing slashes
+	if n.wildcard != nil && segment != "" {
+		m, node := n.wildcard.lookup(segments[1:], httpMethod)
+		if m != nil {
+			return m, node
+		}
+		if pathMatch == nil {
+			pathMatch = node
+		}
+	}
+
+	return nil, pathMatch
+}
+
+// Returns the sorted HTTP methods served by a node
+func (n *routeNode) allowedMethods() []string {
+	httpMethods := make([]string, 0, len(n.methods))
+	for httpMethod := range n.methods {
+		httpMethods = append(httpMethods, httpMethod)
+	}
+	sort.Strings(httpMethods)
+
+	return httpMethods
+}
+
+/*
+INTERNAL:
+Returns the pattern matching method and HTTP method on the given platform, nil if there is none.
+If the path exists but doesn't serve the HTTP method, the HTTP methods it serves are returned instead
+*/
+func (t *routeTable) match(platform string, httpMethod string, method string) (*method, []string) {
+	root, Ok := t.routes[platform]
+	if !Ok {
+		return nil, nil
+	}
+
+	m, node := root.lookup(strings.Split(method, "/"), httpMethod)
+	if m == nil && node != nil {
+		return nil, node.allowedMethods()
+	}
+
+	return m, nil
+}
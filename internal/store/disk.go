@@ -0,0 +1,262 @@
+package store
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+const fileExtension = ".resp"
+
+type diskEntry struct {
+	name     string // file name, the hashed key
+	size     int64
+	accessed time.Time
+}
+
+/*
+Response store that keeps every response in its own file, sharded into directories by the first byte of the hashed key.
+The least recently used files are evicted once the size limit is exceeded. The access order survives restarts through the modification times
+*/
+type DiskStore struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List // front is the most recently used entry
+}
+
+/*
+Opens the store in the given directory and indexes the responses that are already stored.
+Files are evicted right away if they exceed the size limit
+*/
+func NewDiskStore(path string, maxBytes int64) (*DiskStore, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("size limit of response store must be greater than 0")
+	}
+
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+
+	ds := &DiskStore{
+		path:     path,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+
+	var found []*diskEntry
+	err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		// Left behind by writes that were interrupted
+		if filepath.Ext(file) == ".tmp" {
+			os.Remove(file)
+			return nil
+		}
+
+		if filepath.Ext(file) != fileExtension {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		found = append(found, &diskEntry{
+			name:     d.Name()[:len(d.Name())-len(fileExtension)],
+			size:     info.Size(),
+			accessed: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Most recently used first
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].accessed.After(found[j].accessed)
+	})
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for _, entry := range found {
+		ds.entries[entry.name] = ds.lru.PushBack(entry)
+		ds.size += entry.size
+	}
+	ds.evict()
+
+	return ds, nil
+}
+
+func (ds *DiskStore) Get(key string) (*options.StoredResponse, bool) {
+	name := hashKey(key)
+
+	ds.mu.Lock()
+	element, Ok := ds.entries[name]
+	if Ok {
+		ds.lru.MoveToFront(element)
+	}
+	ds.mu.Unlock()
+
+	if !Ok {
+		return nil, false
+	}
+
+	file, err := os.Open(ds.file(name))
+	if err != nil {
+		// The file was evicted or removed in the meantime
+		ds.forget(name, element)
+		return nil, false
+	}
+	defer file.Close()
+
+	var response options.StoredResponse
+	if err := gob.NewDecoder(file).Decode(&response); err != nil {
+		ds.discard(name, element)
+		return nil, false
+	}
+
+	// Keep the access order across restarts
+	now := time.Now()
+	os.Chtimes(ds.file(name), now, now)
+
+	return &response, true
+}
+
+// Writes the response to a temporary file first, so a crash never leaves a partially written response behind
+func (ds *DiskStore) Put(key string, response *options.StoredResponse) error {
+	name := hashKey(key)
+	path := ds.file(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(response)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(file.Name()); err == nil {
+			size = info.Size()
+		}
+	}
+
+	if err == nil && size > ds.maxBytes {
+		err = fmt.Errorf("response of %d bytes exceeds the size limit of the response store", size)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	// Renaming under the lock keeps evict from removing the new file for an old entry of the same name
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if element, Ok := ds.entries[name]; Ok {
+		ds.size -= ds.lru.Remove(element).(*diskEntry).size
+	}
+
+	ds.entries[name] = ds.lru.PushFront(&diskEntry{
+		name:     name,
+		size:     size,
+		accessed: time.Now(),
+	})
+	ds.size += size
+	ds.evict()
+
+	return nil
+}
+
+// Returns the current size of all stored responses in bytes
+func (ds *DiskStore) Size() int64 {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.size
+}
+
+// Removes the least recently used files until the store fits its size limit. Requires the lock
+func (ds *DiskStore) evict() {
+	for ds.size > ds.maxBytes {
+		entry := ds.lru.Remove(ds.lru.Back()).(*diskEntry)
+		delete(ds.entries, entry.name)
+		ds.size -= entry.size
+
+		os.Remove(ds.file(entry.name))
+	}
+}
+
+// Removes the entry, unless the response was stored again in the meantime. Requires the lock
+func (ds *DiskStore) forgetLocked(name string, element *list.Element) bool {
+	if ds.entries[name] != element {
+		return false
+	}
+
+	ds.size -= ds.lru.Remove(element).(*diskEntry).size
+	delete(ds.entries, name)
+	return true
+}
+
+func (ds *DiskStore) forget(name string, element *list.Element) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.forgetLocked(name, element)
+}
+
+// Removes a broken file, unless the response was stored again in the meantime
+func (ds *DiskStore) discard(name string, element *list.Element) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.forgetLocked(name, element) {
+		os.Remove(ds.file(name))
+	}
+}
+
+func (ds *DiskStore) file(name string) string {
+	return filepath.Join(ds.path, name[:2], name+fileExtension)
+}
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
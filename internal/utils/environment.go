@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"math"
 	"os"
@@ -8,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/DarkIntaqt/cosmic-radiance/configs"
+	"github.com/DarkIntaqt/cosmic-radiance/internal/store"
 	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -54,6 +58,22 @@ func GetEnvInt(key string) int {
 	return intValue
 }
 
+// Retrieves the value of the environment variable named by the key as an integer, otherwise returns a fallback.
+func GetSoftEnvInt(key string, defaultValue int) int {
+	value := GetSoftEnvString(key, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Error parsing %s: %v\n", key, err)
+		return defaultValue
+	}
+
+	return intValue
+}
+
 func ValidateRequestMode() options.CosmicRadianceRequestMode {
 	mode := GetEnvString("MODE")
 
@@ -82,6 +102,72 @@ func HandlePriorityQueueSize() float32 {
 	return float32(value) / 100
 }
 
+/*
+Reads the priority classes from PRIORITY_CLASSES, highest priority first.
+Each class is given as name:share:batch[:reserve][:burst], the queue share and the reserve in percent
+*/
+func HandlePriorityClasses() []options.PriorityClass {
+	value := GetSoftEnvString("PRIORITY_CLASSES", "")
+	if value == "" {
+		return nil
+	}
+
+	var classes []options.PriorityClass
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) < 3 || len(fields) > 5 {
+			panic("Invalid PRIORITY_CLASSES entry " + entry + ", must be name:share:batch[:reserve][:burst]")
+		}
+
+		share, err := strconv.ParseFloat(fields[1], 32)
+		if err != nil {
+			panic("Invalid queue share in PRIORITY_CLASSES entry " + entry)
+		}
+
+		batch, err := strconv.Atoi(fields[2])
+		if err != nil {
+			panic("Invalid batch size in PRIORITY_CLASSES entry " + entry)
+		}
+
+		class := options.PriorityClass{
+			Name:       strings.TrimSpace(fields[0]),
+			QueueShare: float32(math.Max(share, 0) / 100),
+			BatchSize:  batch,
+		}
+
+		for _, field := range fields[3:] {
+			if strings.ToLower(field) == "burst" {
+				class.Burst = true
+				continue
+			}
+
+			reserve, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				panic("Invalid reserve in PRIORITY_CLASSES entry " + entry)
+			}
+			class.Reserve = float32(math.Min(math.Max(reserve, 0), 99) / 100)
+		}
+
+		classes = append(classes, class)
+	}
+
+	return classes
+}
+
+// Reads the share of each limit that is reserved for high priority requests, in percent
+func HandlePriorityReserve() float32 {
+	value, err := strconv.ParseFloat(GetSoftEnvString("PRIORITY_RESERVE", "0"), 32)
+	if err != nil {
+		log.Printf("Error parsing PRIORITY_RESERVE: %v\n", err)
+		return 0
+	}
+
+	// Clamp the value, normal requests keep at least a percent of each limit
+	value = math.Min(math.Max(value, 0), 99)
+
+	return float32(value) / 100
+}
+
 func HandleDuration(unit string, envName string, defaultDuration time.Duration) time.Duration {
 	limit := GetSoftEnvString(envName, "false")
 	if limit == "false" {
@@ -96,3 +182,153 @@ func HandleDuration(unit string, envName string, defaultDuration time.Duration)
 
 	return duration
 }
+
+// Reads the known rate limits from the JSON file set in RATE_LIMITS_FILE. Panics if the file is unusable, like on invalid limits
+func HandleRateLimitSeeds() options.RateLimitSeeds {
+	seeds := options.RateLimitSeeds{}
+
+	path := GetSoftEnvString("RATE_LIMITS_FILE", "")
+	if path == "" {
+		return seeds
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read RATE_LIMITS_FILE %s: %v", path, err))
+	}
+
+	if err := json.Unmarshal(data, &seeds); err != nil {
+		panic(fmt.Sprintf("Failed to parse RATE_LIMITS_FILE %s: %v", path, err))
+	}
+
+	return seeds
+}
+
+// Reads the circuit breaker settings, the error ratio is given in percent
+func HandleCircuitBreaker() options.CircuitBreakerOptions {
+	ratio := 0.0
+	if value := GetSoftEnvString("CIRCUIT_BREAKER_RATIO", ""); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Printf("Error parsing CIRCUIT_BREAKER_RATIO: %v\n", err)
+		} else {
+			// Clamp the value and make it a ratio
+			ratio = math.Min(math.Max(parsed, 0), 100) / 100
+		}
+	}
+
+	var perMethod bool
+	switch strings.ToLower(GetSoftEnvString("CIRCUIT_BREAKER_SCOPE", "platform")) {
+	case "platform":
+		perMethod = false
+	case "method":
+		perMethod = true
+	default:
+		panic("Invalid CIRCUIT_BREAKER_SCOPE, must be 'PLATFORM' or 'METHOD'")
+	}
+
+	return options.CircuitBreakerOptions{
+		ErrorRatio:   ratio,
+		MinRequests:  GetSoftEnvInt("CIRCUIT_BREAKER_MIN_REQUESTS", configs.DEFAULT_CIRCUIT_BREAKER_MIN_REQUESTS),
+		Window:       HandleDuration("s", "CIRCUIT_BREAKER_WINDOW", configs.DEFAULT_CIRCUIT_BREAKER_WINDOW),
+		OpenDuration: HandleDuration("s", "CIRCUIT_BREAKER_OPEN_DURATION", configs.DEFAULT_CIRCUIT_BREAKER_OPEN_DURATION),
+		PerMethod:    perMethod,
+	}
+}
+
+/*
+Reads the response cache settings. The size is given in megabytes, the TTLs are read from the JSON file set in CACHE_TTLS_FILE.
+TTLs are Go durations such as "30s" or "10m", "forever" never expires
+*/
+func HandleCache() options.CacheOptions {
+	cache := options.CacheOptions{
+		MaxBytes:    int64(GetSoftEnvInt("CACHE_SIZE", 0)) << 20,
+		NotFoundTTL: HandleDuration("s", "CACHE_NOT_FOUND_TTL", configs.DEFAULT_CACHE_NOT_FOUND_TTL),
+		TTLs:        make(map[string]time.Duration),
+	}
+
+	path := GetSoftEnvString("CACHE_TTLS_FILE", "")
+	if path == "" {
+		return cache
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading CACHE_TTLS_FILE: %v\n", err)
+		return cache
+	}
+
+	ttls := map[string]string{}
+	if err := json.Unmarshal(data, &ttls); err != nil {
+		log.Printf("Error parsing CACHE_TTLS_FILE: %v\n", err)
+		return cache
+	}
+
+	for endpoint, value := range ttls {
+		if value == "forever" {
+			cache.TTLs[endpoint] = -1
+			continue
+		}
+
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			log.Printf("Error parsing TTL of %s in CACHE_TTLS_FILE: %q\n", endpoint, value)
+			continue
+		}
+		cache.TTLs[endpoint] = ttl
+	}
+
+	return cache
+}
+
+// Opens the response store in the directory set in STORE_PATH. The size is given in megabytes
+func HandleResponseStore() options.ResponseStore {
+	path := GetSoftEnvString("STORE_PATH", "")
+	if path == "" {
+		return nil
+	}
+
+	maxBytes := int64(GetSoftEnvInt("STORE_SIZE", configs.DEFAULT_STORE_SIZE>>20)) << 20
+	diskStore, err := store.NewDiskStore(path, maxBytes)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to open response store %s: %v", path, err))
+	}
+
+	log.Printf("Using response store %s with %d MB of %d MB used\n", path, diskStore.Size()>>20, maxBytes>>20)
+	return diskStore
+}
+
+// Reads the comma separated endpoints whose responses are stored
+func HandleStoreEndpoints() []string {
+	var endpoints []string
+	for _, endpoint := range strings.Split(GetSoftEnvString("STORE_ENDPOINTS", configs.DEFAULT_STORE_ENDPOINTS), ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	return endpoints
+}
+
+// Reads the tenant header from TENANT_HEADER and the weights, queue shares and quotas of tenants from the JSON file set in TENANTS_FILE. Panics if the file is unusable
+func HandleTenants() options.TenantOptions {
+	tenants := options.TenantOptions{
+		Header: GetSoftEnvString("TENANT_HEADER", ""),
+	}
+
+	path := GetSoftEnvString("TENANTS_FILE", "")
+	if path == "" {
+		return tenants
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read TENANTS_FILE %s: %v", path, err))
+	}
+
+	if err := json.Unmarshal(data, &tenants.Tenants); err != nil {
+		panic(fmt.Sprintf("Failed to parse TENANTS_FILE %s: %v", path, err))
+	}
+
+	return tenants
+}
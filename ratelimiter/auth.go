@@ -0,0 +1,45 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DarkIntaqt/cosmic-radiance/internal/auth"
+)
+
+/*
+Signs a request to cosmic-radiance with the secret of the client, for proxies which require authentication.
+The signature covers the body, which is read and replaced. Each signed request can only be sent once
+*/
+func SignRequest(req *http.Request, clientId string, secret string, now time.Time) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// The Host header is taken from the URL, unless it is set explicitly
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	timestamp := now.Unix()
+	signature := auth.Sign([]byte(secret), timestamp, req.Method, host, req.URL.RequestURI(), body)
+
+	req.Header.Set(auth.ClientIdHeader, clientId)
+	req.Header.Set(auth.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(auth.SignatureHeader, hex.EncodeToString(signature))
+
+	return nil
+}
@@ -70,3 +70,13 @@ func (cr *cosmicRadiance) Stop() error {
 
 	return nil
 }
+
+// Re-fetches the route table from the configured source without restarting. Safe to call while cosmic-radiance is running
+func (cr *cosmicRadiance) RefreshRoutes() error {
+	return cr.instance.RefreshRoutes()
+}
+
+// Returns the router of this instance, which follows every refresh of the route table
+func (cr *cosmicRadiance) Router() *Router {
+	return cr.instance.Router()
+}
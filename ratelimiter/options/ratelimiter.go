@@ -17,16 +17,75 @@ type KeyKV struct {
 	Name   string
 }
 
+/*
+Known rate limits in the format of Riot's rate limit headers, e.g. "20:1,100:120".
+Queues start with these limits instead of placeholders. Limits reported by Riot still override them.
+*/
+type RateLimitSeeds struct {
+	AppLimits    map[string]string            `json:"app"`    // by key name, "*" applies to all keys
+	MethodLimits map[string]map[string]string `json:"method"` // by endpoint, e.g. "lol/match/v5/matches/{matchId}" or "POST lol/tournament/v5/codes", then by platform, "*" applies to all platforms
+}
+
+/*
+A priority class, selected by name or index with the X-Priority header.
+Classes are ordered from the highest to the lowest priority, higher classes are always dispatched first
+*/
+type PriorityClass struct {
+	Name       string
+	QueueShare float32 // Queue size as a share of the peak capacity
+	BatchSize  int     // Requests dispatched per polling interval and queue
+	Burst      bool    // Dispatch as fast as the limits allow, instead of spreading requests across the window
+	Reserve    float32 // Share of each app and method limit the class leaves to higher classes
+}
+
+// Circuit breaker per platform (or method) which fails fast during upstream outages
+type CircuitBreakerOptions struct {
+	ErrorRatio   float64       // Ratio of failed upstream requests within the window that opens the breaker. Disabled if 0
+	MinRequests  int           // Minimum amount of requests within the window before the ratio is considered
+	Window       time.Duration // Window the error ratio is computed in
+	OpenDuration time.Duration // Time the breaker stays open before a probe request is let through
+	PerMethod    bool          // Use one breaker per method instead of one per platform
+}
+
+// In-memory cache of responses in front of the queues
+type CacheOptions struct {
+	MaxBytes    int64                    // Size of all cached responses. Disabled if 0
+	TTLs        map[string]time.Duration // by endpoint, e.g. "lol/match/v5/matches/{matchId}", "*" applies to all endpoints. Negative TTLs never expire
+	NotFoundTTL time.Duration            // TTL of 404 responses, capped by the TTL of the endpoint. Not cached if 0
+}
+
 type RateLimiterOptions struct {
-	ApiKeys              []KeyKV
-	Port                 int
-	RequestMode          CosmicRadianceRequestMode
-	Timeout              time.Duration
-	PriorityQueueSize    float32
-	PrometheusEnabled    bool
-	PollingInterval      time.Duration
-	AdditionalWindowSize time.Duration
-	UserAgent            string
+	ApiKeys               []KeyKV
+	Port                  int
+	RequestMode           CosmicRadianceRequestMode
+	Timeout               time.Duration
+	MinTimeout            time.Duration   // Lower bound of the X-Timeout header
+	MaxTimeout            time.Duration   // Upper bound of the X-Timeout header. Defaults to Timeout if 0
+	PriorityQueueSize     float32         // Queue share of the default "high" class, if no classes are configured
+	PriorityReserve       float32         // Share of each limit the default "normal" class leaves to the "high" class, if no classes are configured
+	PriorityClasses       []PriorityClass // Defaults to "high" and "normal" if empty
+	DefaultPriority       string          // Class of requests without a X-Priority header. Defaults to the lowest class
+	PrometheusEnabled     bool
+	PollingInterval       time.Duration
+	AdditionalWindowSize  time.Duration
+	UserAgent             string
+	SchemaSource          string        // File path or URL of an OpenAPI spec. Uses the embedded route table if empty
+	SchemaRefreshInterval time.Duration // Interval in which the route table is refreshed. Disabled if 0
+	SnapshotPath          string        // File the discovered rate limits are persisted to. Disabled if empty
+	SnapshotInterval      time.Duration // Interval in which the snapshot is written, additionally to the shutdown
+	SnapshotMaxAge        time.Duration // Snapshots older than this are ignored at startup
+	RateLimitSeeds        RateLimitSeeds
+	MaxRetries            int // Retries of upstream 5xx and transport failures within the timeout. Disabled if 0
+	CircuitBreaker        CircuitBreakerOptions
+	Cache                 CacheOptions
+	CoalesceRequests      bool          // Identical GET requests in flight share one queue slot and one upstream call
+	ResponseStore         ResponseStore // Persistent store of responses of immutable endpoints. Disabled if nil
+	StoreEndpoints        []string      // Endpoints whose responses are stored, e.g. "lol/match/v5/matches/{matchId}"
+	Tenants               TenantOptions
+	AuthFile              string        // JSON file with the credentials of clients, which then have to authenticate. Reloaded when it changes. Disabled if empty
+	AdminPort             int           // Port of the admin API. Disabled if 0
+	AdminToken            string        // Bearer token of the admin API, required for operations. Operations are disabled if empty
+	ShutdownDelay         time.Duration // Time the proxy keeps serving after failing the readiness probe at shutdown
 }
 
 func ValidateRateLimiterOptions(opts *RateLimiterOptions) {
@@ -39,14 +98,55 @@ func ValidateRateLimiterOptions(opts *RateLimiterOptions) {
 		panic("Invalid port number")
 	}
 
+	if opts.AdminPort < 0 || opts.AdminPort > 65535 || opts.AdminPort == opts.Port {
+		panic("Invalid admin port number, it has to differ from the port")
+	}
+
 	if opts.Timeout <= 0 {
 		panic("Timeout must be greater than 0")
 	}
 
+	if opts.MinTimeout < 0 || opts.MaxTimeout < 0 {
+		panic("Min and max timeout must be greater than or equal to 0")
+	}
+
+	if opts.MaxTimeout > 0 && opts.MinTimeout > opts.MaxTimeout {
+		panic("Min timeout must not be greater than max timeout")
+	}
+
 	if opts.PriorityQueueSize < 0 || opts.PriorityQueueSize > 1 {
 		panic("Priority queue size must be between 0 and 1")
 	}
 
+	if opts.PriorityReserve < 0 || opts.PriorityReserve >= 1 {
+		panic("Priority reserve must be between 0 and 1")
+	}
+
+	names := make(map[string]bool, len(opts.PriorityClasses))
+	for _, class := range opts.PriorityClasses {
+		if class.Name == "" || names[class.Name] {
+			panic("Priority class names must be unique and not empty")
+		}
+		names[class.Name] = true
+
+		if class.QueueShare < 0 || class.BatchSize <= 0 {
+			panic("Priority class " + class.Name + " needs a queue share of at least 0 and a batch size greater than 0")
+		}
+
+		if class.Reserve < 0 || class.Reserve >= 1 {
+			panic("Priority class " + class.Name + " needs a reserve between 0 and 1")
+		}
+	}
+
+	// Without classes, the default classes "high" and "normal" are used
+	if len(opts.PriorityClasses) == 0 {
+		names["high"], names["normal"] = true, true
+	}
+
+	if opts.DefaultPriority != "" && !names[opts.DefaultPriority] {
+		panic("Default priority " + opts.DefaultPriority + " is not a priority class")
+	}
+
 	if opts.PollingInterval <= 0 {
 		panic("Polling interval must be greater than 0")
 	}
@@ -55,6 +155,77 @@ func ValidateRateLimiterOptions(opts *RateLimiterOptions) {
 		panic("Additional window size must be greater than or equal to 0")
 	}
 
+	if opts.SchemaRefreshInterval < 0 {
+		panic("Schema refresh interval must be greater than or equal to 0")
+	}
+
+	// The embedded route table is never refreshed, the refresh would do nothing but log
+	if opts.SchemaRefreshInterval > 0 && opts.SchemaSource == "" {
+		panic("Schema refresh interval requires a schema source")
+	}
+
+	if opts.SnapshotPath != "" && opts.SnapshotInterval < 0 {
+		panic("Snapshot interval must be greater than or equal to 0")
+	}
+
+	if opts.SnapshotPath != "" && opts.SnapshotMaxAge <= 0 {
+		panic("Snapshot max age must be greater than 0")
+	}
+
+	if opts.ShutdownDelay < 0 {
+		panic("Shutdown delay must be greater than or equal to 0")
+	}
+
+	if opts.MaxRetries < 0 {
+		panic("Max retries must be greater than or equal to 0")
+	}
+
+	if opts.CircuitBreaker.ErrorRatio < 0 || opts.CircuitBreaker.ErrorRatio > 1 {
+		panic("Circuit breaker error ratio must be between 0 and 1")
+	}
+
+	if opts.CircuitBreaker.ErrorRatio > 0 {
+		if opts.CircuitBreaker.MinRequests <= 0 {
+			panic("Circuit breaker min requests must be greater than 0")
+		}
+
+		if opts.CircuitBreaker.Window <= 0 || opts.CircuitBreaker.OpenDuration <= 0 {
+			panic("Circuit breaker window and open duration must be greater than 0")
+		}
+	}
+
+	if opts.Cache.MaxBytes < 0 {
+		panic("Cache size must be greater than or equal to 0")
+	}
+
+	if opts.Cache.NotFoundTTL < 0 {
+		panic("Cache not found TTL must be greater than or equal to 0")
+	}
+
+	// Without known tenants, every tenant header maps to "*" and all requests share one lane
+	if opts.Tenants.Header != "" && opts.AuthFile == "" && len(opts.Tenants.Tenants) == 0 {
+		panic("Tenant header requires tenants")
+	}
+
+	for id, tenant := range opts.Tenants.Tenants {
+		if tenant.Weight < 0 {
+			panic("Tenant " + id + " needs a weight greater than or equal to 0")
+		}
+
+		if tenant.QueueShare < 0 || tenant.QueueShare > 1 {
+			panic("Tenant " + id + " needs a queue share between 0 and 1")
+		}
+
+		if tenant.QuotaScope != "" && tenant.QuotaScope != "platform" && tenant.QuotaScope != "method" {
+			panic("Tenant " + id + " needs a quota scope of either platform or method")
+		}
+
+		// Clients choose the tenant header freely, so they could simply use another tenant's budget
+		if tenant.Quota != "" && opts.AuthFile == "" {
+			panic("Tenant " + id + " has a quota, which requires clients to authenticate")
+		}
+	}
+
 	if opts.UserAgent == "" {
 		panic("UserAgent should not be empty")
 	}
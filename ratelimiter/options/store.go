@@ -0,0 +1,22 @@
+package options
+
+import "net/http"
+
+// Response as received from the Riot Games API. The body is kept encoded, e.g. gzip, so it can be written 1:1
+type StoredResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+/*
+Persistent storage of responses of immutable endpoints, e.g. match-v5 matches. The store is consulted before a request is queued,
+so stored responses don't spend any rate limit. Implementations must be safe for concurrent use
+*/
+type ResponseStore interface {
+	// Returns the stored response of the key, if there is one
+	Get(key string) (*StoredResponse, bool)
+
+	// Stores the response of the key, replacing an existing one
+	Put(key string, response *StoredResponse) error
+}
@@ -0,0 +1,54 @@
+package options
+
+// A client of the proxy. Tenants share each method queue by their weight
+type Tenant struct {
+	Weight     float64 `json:"weight"`     // Share of the dispatched requests relative to other tenants. Defaults to 1 if 0
+	QueueShare float32 `json:"queueShare"` // Share of each method queue the tenant may fill. Defaults to 1 if 0
+	Quota      string  `json:"quota"`      // Budget in the format of Riot's rate limit headers, e.g. "10:1,300:60". Unlimited if empty
+	QuotaScope string  `json:"quotaScope"` // Whether the budget applies to all requests, per "platform" or per "method". Defaults to all requests
+}
+
+// Fair queuing across the clients of the proxy
+type TenantOptions struct {
+	Header  string            // Header which identifies the tenant of a request, e.g. "X-Tenant". Ignored if clients authenticate, they are the tenants then
+	Tenants map[string]Tenant // by tenant id, "*" applies to all unknown tenants
+}
+
+// Returns the settings of a tenant, falling back to "*" and the defaults
+func (opts *TenantOptions) Tenant(id string) Tenant {
+	tenant, Ok := opts.Tenants[id]
+	if !Ok {
+		tenant = opts.Tenants["*"]
+	}
+
+	if tenant.Weight == 0 {
+		tenant.Weight = 1
+	}
+
+	if tenant.QueueShare == 0 {
+		tenant.QueueShare = 1
+	}
+
+	return tenant
+}
+
+// Returns whether requests are assigned to tenants, either by the tenant header or by the authenticated client
+func (opts *RateLimiterOptions) TenantsEnabled() bool {
+	return opts.Tenants.Header != "" || opts.AuthFile != ""
+}
+
+/*
+Returns the tenant as metrics label. Authenticated clients are a known set, other unknown tenants are grouped,
+so clients can't create labels
+*/
+func (opts *RateLimiterOptions) TenantLabel(id string) string {
+	if id == "" || id == "*" {
+		return "default"
+	}
+
+	if _, Ok := opts.Tenants.Tenants[id]; !Ok && opts.AuthFile == "" {
+		return "default"
+	}
+
+	return id
+}
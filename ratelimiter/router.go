@@ -0,0 +1,23 @@
+package ratelimiter
+
+import (
+	"github.com/DarkIntaqt/cosmic-radiance/internal/schema"
+)
+
+// Matches Riot Games API requests with exactly the same logic the proxy uses
+type Router = schema.Router
+
+// Result of a successful match
+type Syntax = schema.Syntax
+
+// Errors returned by Router.Match
+type (
+	InvalidPathSyntaxError = schema.InvalidPathSyntaxError
+	InvalidParameterError  = schema.InvalidParameterError
+	MethodNotAllowedError  = schema.MethodNotAllowedError
+)
+
+// Creates a standalone router from a file path or URL of an OpenAPI spec. Uses the embedded route table if source is empty
+func NewRouter(source string) (*Router, error) {
+	return schema.NewRouter(source)
+}
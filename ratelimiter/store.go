@@ -0,0 +1,22 @@
+package ratelimiter
+
+import (
+	"github.com/DarkIntaqt/cosmic-radiance/internal/store"
+	"github.com/DarkIntaqt/cosmic-radiance/ratelimiter/options"
+)
+
+// Persistent storage of responses of immutable endpoints, set in RateLimiterOptions.ResponseStore
+type ResponseStore = options.ResponseStore
+
+// Response as received from the Riot Games API
+type StoredResponse = options.StoredResponse
+
+// Creates a response store in the given directory, which evicts the least recently used responses once maxBytes is exceeded
+func NewDiskResponseStore(path string, maxBytes int64) (ResponseStore, error) {
+	diskStore, err := store.NewDiskStore(path, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return diskStore, nil
+}